@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/binsquare/envmap/provider"
 	"gopkg.in/yaml.v3"
@@ -21,6 +23,86 @@ type EnvConfig struct {
 	Source     string `yaml:"source,omitempty"` // deprecated, use Provider
 	PathPrefix string `yaml:"path_prefix"`
 	Prefix     string `yaml:"prefix"`
+	// Sources layers several providers into one env, lowest precedence
+	// first; it replaces provider/prefix/path_prefix.
+	Sources []SourceConfig `yaml:"sources,omitempty"`
+	// Extends names an env whose resolved secrets this env inherits; this
+	// env's own provider or sources override them key by key.
+	Extends string `yaml:"extends,omitempty"`
+	// Mapping renames provider keys to env var names for this env.
+	Mapping KeyMapping `yaml:"mapping,omitempty"`
+	// Interpolate expands ${KEY} references between this env's values.
+	Interpolate InterpolateConfig `yaml:"interpolate,omitempty"`
+	// ResolveRefs set to false keeps values such as op://vault/item literal
+	// instead of resolving them as references; unset means true.
+	ResolveRefs *bool `yaml:"resolve_refs,omitempty"`
+	// Required and Optional declare the keys the app expects in this env.
+	Required []KeySpec `yaml:"required,omitempty"`
+	Optional []KeySpec `yaml:"optional,omitempty"`
+}
+
+// SourceConfig is one layer of a multi-source env.
+type SourceConfig struct {
+	Provider   string `yaml:"provider"`
+	PathPrefix string `yaml:"path_prefix,omitempty"`
+	Prefix     string `yaml:"prefix,omitempty"`
+}
+
+// resolvesRefs reports whether secret references in the env's values are
+// replaced by the secrets they point at.
+func (e EnvConfig) resolvesRefs() bool {
+	return e.ResolveRefs == nil || *e.ResolveRefs
+}
+
+// Layers returns the env's sources as single-provider envs, lowest
+// precedence first. An env without sources is one layer, unless it only
+// extends another env and has no provider of its own.
+func (e EnvConfig) Layers() []EnvConfig {
+	if len(e.Sources) == 0 {
+		if e.GetProvider() == "" && e.Extends != "" {
+			return nil
+		}
+		return []EnvConfig{e}
+	}
+	layers := make([]EnvConfig, len(e.Sources))
+	for i, s := range e.Sources {
+		layers[i] = EnvConfig{Provider: s.Provider, PathPrefix: s.PathPrefix, Prefix: s.Prefix}
+	}
+	return layers
+}
+
+// WriteTarget returns the layer that set, delete and rollback act on: the
+// highest-precedence source, so writes shadow values from lower layers. It
+// reports false for an env that only extends another and has no layer.
+func (e EnvConfig) WriteTarget() (EnvConfig, bool) {
+	layers := e.Layers()
+	if len(layers) == 0 {
+		return EnvConfig{}, false
+	}
+	return layers[len(layers)-1], true
+}
+
+// SourceLabel names a layer for provenance output.
+func (e EnvConfig) SourceLabel() string {
+	if prefix := provider.ResolvedPrefix(e.ToProviderConfig()); prefix != "" {
+		return e.GetProvider() + ":" + prefix
+	}
+	return e.GetProvider()
+}
+
+func (e EnvConfig) validateSources() error {
+	if len(e.Sources) == 0 {
+		return nil
+	}
+	if e.GetProvider() != "" || e.Prefix != "" || e.PathPrefix != "" {
+		return errors.New("use either sources or provider/prefix/path_prefix, not both")
+	}
+	for i, s := range e.Sources {
+		if s.Provider == "" {
+			return fmt.Errorf("source %d missing provider", i+1)
+		}
+	}
+	return nil
 }
 
 func (e EnvConfig) GetProvider() string {
@@ -79,6 +161,9 @@ func LoadGlobalConfig(path string) (GlobalConfig, error) {
 		}
 		return GlobalConfig{}, fmt.Errorf("read global config: %w", err)
 	}
+	if err := validateGlobalConfig(path, raw); err != nil {
+		return GlobalConfig{}, err
+	}
 	var cfg GlobalConfig
 	if err := yaml.Unmarshal(raw, &cfg); err != nil {
 		return GlobalConfig{}, fmt.Errorf("parse global config: %w", err)
@@ -89,6 +174,89 @@ func LoadGlobalConfig(path string) (GlobalConfig, error) {
 	return cfg, nil
 }
 
+// ConfigError lists every schema violation found in a config file.
+type ConfigError struct {
+	Path   string
+	Issues []provider.FieldError
+}
+
+func (e *ConfigError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid config %s:", e.Path)
+	for _, issue := range e.Issues {
+		fmt.Fprintf(&b, "\n  %s:%d:%d: %s", e.Path, issue.Line, issue.Column, issue.Error())
+	}
+	return b.String()
+}
+
+// validateGlobalConfig checks each provider block against its type's field
+// schema so typos and mistyped values fail at load time with a position.
+func validateGlobalConfig(path string, raw []byte) error {
+	var root yaml.Node
+	if err := yaml.Unmarshal(raw, &root); err != nil {
+		return fmt.Errorf("parse global config: %w", err)
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+	doc := root.Content[0]
+	var issues []provider.FieldError
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		key, block := doc.Content[i], doc.Content[i+1]
+		if key.Value != "providers" && key.Value != "sources" {
+			issues = append(issues, provider.FieldError{Field: key.Value, Line: key.Line, Column: key.Column, Msg: "unknown top-level field (expected providers)"})
+			continue
+		}
+		if block.Kind != yaml.MappingNode {
+			continue
+		}
+		for j := 0; j+1 < len(block.Content); j += 2 {
+			issues = append(issues, provider.ValidateConfigNode(block.Content[j].Value, block.Content[j+1])...)
+		}
+	}
+	if len(issues) == 0 {
+		return nil
+	}
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Line != issues[j].Line {
+			return issues[i].Line < issues[j].Line
+		}
+		return issues[i].Column < issues[j].Column
+	})
+	return &ConfigError{Path: path, Issues: issues}
+}
+
+// globalConfigWarnings reports problems in the global config that do not stop
+// it from loading, such as credentials written into it in plaintext.
+func globalConfigWarnings(path string) ([]provider.FieldError, error) {
+	if path == "" {
+		path = DefaultGlobalConfigPath()
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read global config: %w", err)
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(raw, &root); err != nil {
+		return nil, fmt.Errorf("parse global config: %w", err)
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	doc := root.Content[0]
+	var warnings []provider.FieldError
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		block := doc.Content[i+1]
+		if (doc.Content[i].Value != "providers" && doc.Content[i].Value != "sources") || block.Kind != yaml.MappingNode {
+			continue
+		}
+		for j := 0; j+1 < len(block.Content); j += 2 {
+			warnings = append(warnings, provider.PlaintextSecrets(block.Content[j].Value, block.Content[j+1])...)
+		}
+	}
+	return warnings, nil
+}
+
 func (c ProjectConfig) Validate() error {
 	if c.Project == "" {
 		return errors.New("project config missing project name")
@@ -102,9 +270,48 @@ func (c ProjectConfig) Validate() error {
 	if _, ok := c.Envs[c.DefaultEnv]; !ok {
 		return fmt.Errorf("default_env %q not found in envs", c.DefaultEnv)
 	}
+	for name, env := range c.Envs {
+		if _, err := c.ExtendsChain(name); err != nil {
+			return err
+		}
+		if err := env.validateSources(); err != nil {
+			return fmt.Errorf("env %q: %w", name, err)
+		}
+		if err := env.Mapping.validate(); err != nil {
+			return fmt.Errorf("env %q: %w", name, err)
+		}
+		if err := env.validateKeySchema(); err != nil {
+			return fmt.Errorf("env %q: %w", name, err)
+		}
+	}
 	return nil
 }
 
+// ExtendsChain returns name followed by the envs it inherits from, nearest
+// first. It fails on unknown parents and inheritance cycles.
+func (c ProjectConfig) ExtendsChain(name string) ([]string, error) {
+	chain := []string{name}
+	seen := map[string]bool{name: true}
+	for current := name; ; {
+		env, ok := c.Envs[current]
+		if !ok {
+			return nil, fmt.Errorf("env %q not found in project config", current)
+		}
+		if env.Extends == "" {
+			return chain, nil
+		}
+		if _, ok := c.Envs[env.Extends]; !ok {
+			return nil, fmt.Errorf("env %q extends unknown env %q", current, env.Extends)
+		}
+		if seen[env.Extends] {
+			return nil, fmt.Errorf("env %q: extends cycle %s", name, strings.Join(append(chain, env.Extends), " → "))
+		}
+		seen[env.Extends] = true
+		chain = append(chain, env.Extends)
+		current = env.Extends
+	}
+}
+
 func ResolveEnv(cfg ProjectConfig, requested string) (string, error) {
 	if requested != "" {
 		if _, ok := cfg.Envs[requested]; ok {
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/binsquare/envmap/provider"
@@ -279,3 +281,60 @@ func TestLoadProjectConfigHelper(t *testing.T) {
 		t.Fatalf("auto-discovered path = %s, want %s", real1, real2)
 	}
 }
+
+func TestLoadGlobalConfigSchema(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	src := "providers:\n  vault-dev:\n    type: vault\n    adress: https://vault:8200\n  aws:\n    type: aws-ssm\n    region: 1\n"
+	if err := os.WriteFile(cfgPath, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LoadGlobalConfig(cfgPath)
+	var cfgErr *ConfigError
+	if !errors.As(err, &cfgErr) {
+		t.Fatalf("LoadGlobalConfig error = %v, want *ConfigError", err)
+	}
+	if len(cfgErr.Issues) != 2 {
+		t.Fatalf("issues = %v, want 2", cfgErr.Issues)
+	}
+	if got := cfgErr.Issues[0]; got.Line != 4 || got.Field != "adress" {
+		t.Errorf("first issue = %+v, want adress at line 4", got)
+	}
+	if got := cfgErr.Issues[1]; got.Line != 7 || got.Field != "region" {
+		t.Errorf("second issue = %+v, want region at line 7", got)
+	}
+	if !strings.Contains(err.Error(), cfgPath+":4:5") {
+		t.Errorf("error %q missing file:line:column position", err)
+	}
+}
+
+func TestLoadGlobalConfigWrittenByInit(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	keyPath := filepath.Join(dir, "key")
+	if err := provider.GenerateKeyFile(keyPath); err != nil {
+		t.Fatal(err)
+	}
+	cfg := GlobalConfig{Providers: map[string]provider.ProviderConfig{
+		"local-dev": localFileProviderConfig(filepath.Join(dir, "secrets.db"), keyPath),
+	}}
+	if err := writeGlobalConfig(cfgPath, cfg); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadGlobalConfig(cfgPath)
+	if err != nil {
+		t.Fatalf("LoadGlobalConfig on init output: %v", err)
+	}
+	if got := loaded.GetProviders()["local-dev"].Encryption; got == nil || got.KeyFile != keyPath {
+		t.Errorf("encryption = %+v, want key_file %s", got, keyPath)
+	}
+
+	// Configs written before type was omitted carry an explicit empty string.
+	src := "providers:\n  local-dev:\n    type: local-file\n    path: /tmp/s.db\n    encryption:\n      type: \"\"\n      key_file: " + keyPath + "\n"
+	if err := os.WriteFile(cfgPath, []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadGlobalConfig(cfgPath); err != nil {
+		t.Errorf("LoadGlobalConfig with encryption.type \"\": %v", err)
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
 
 	"github.com/binsquare/envmap/provider"
 )
@@ -36,16 +39,51 @@ func NewProvider(envName string, envCfg EnvConfig, globalCfg GlobalConfig) (prov
 		}
 	}
 
+	return newProviderFromConfig(providerName, envCfg, providerCfg)
+}
+
+// newProviderFromConfig instantiates a named provider block from the global config.
+func newProviderFromConfig(providerName string, envCfg EnvConfig, providerCfg provider.ProviderConfig) (provider.Provider, error) {
 	info, ok := provider.Get(providerCfg.Type)
 	if !ok {
 		return nil, fmt.Errorf("unknown provider type %q for provider %q. Available: %v", providerCfg.Type, providerName, provider.ListTypes())
 	}
+	providerCfg, err := withPromptedPassphrase(providerName, providerCfg)
+	if err != nil {
+		return nil, err
+	}
+	if providerCfg.Type == "project-file" {
+		providerCfg.Path = projectRelativePath(providerCfg.Path)
+	}
 
 	return info.Factory(envCfg.ToProviderConfig(), providerCfg)
 }
 
+// projectRelativePath resolves a project-file path against the directory
+// holding .envmap.yaml, so the secrets file sits next to it regardless of cwd.
+func projectRelativePath(path string) string {
+	if path == "" {
+		path = provider.DefaultProjectFilePath
+	}
+	if filepath.IsAbs(path) {
+		return path
+	}
+	cfgPath := projectConfigPath
+	if cfgPath == "" {
+		found, err := FindProjectConfig("")
+		if err != nil {
+			return path
+		}
+		cfgPath = found
+	}
+	return filepath.Join(filepath.Dir(cfgPath), path)
+}
+
+// CollectEnv fetches the env's secrets, expands ${KEY} references when the
+// env enables interpolation, and fails if the result does not satisfy the
+// env's required/optional key schema.
 func CollectEnv(ctx context.Context, projectCfg ProjectConfig, globalCfg GlobalConfig, envName string) (map[string]string, error) {
-	records, err := CollectEnvWithMetadata(ctx, projectCfg, globalCfg, envName)
+	records, err := CollectInterpolatedEnv(ctx, projectCfg, globalCfg, envName)
 	if err != nil {
 		return nil, err
 	}
@@ -53,19 +91,228 @@ func CollectEnv(ctx context.Context, projectCfg ProjectConfig, globalCfg GlobalC
 	for k, rec := range records {
 		out[k] = rec.Value
 	}
+	if report := projectCfg.Envs[envName].CheckKeys(out); !report.OK() {
+		return nil, &KeySchemaError{Env: envName, Report: report}
+	}
 	return out, nil
 }
 
+// CollectInterpolatedEnv is CollectEnvWithMetadata with ${KEY} references
+// expanded the way run and export see them, without checking the key schema.
+func CollectInterpolatedEnv(ctx context.Context, projectCfg ProjectConfig, globalCfg GlobalConfig, envName string) (map[string]provider.SecretRecord, error) {
+	records, err := CollectEnvWithMetadata(ctx, projectCfg, globalCfg, envName)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(records))
+	for k, rec := range records {
+		values[k] = rec.Value
+	}
+	values, err = Interpolate(values, projectCfg.Envs[envName].Interpolate, os.LookupEnv)
+	if err != nil {
+		return nil, fmt.Errorf("env %q: %w", envName, err)
+	}
+	for k, v := range values {
+		rec := records[k]
+		rec.Value = v
+		records[k] = rec
+	}
+	return records, nil
+}
+
 func CollectEnvWithMetadata(ctx context.Context, projectCfg ProjectConfig, globalCfg GlobalConfig, envName string) (map[string]provider.SecretRecord, error) {
 	envCfg, ok := projectCfg.Envs[envName]
 	if !ok {
 		return nil, fmt.Errorf("env %q not found in project config", envName)
 	}
-	p, err := NewProvider(envName, envCfg, globalCfg)
+	chain, err := projectCfg.ExtendsChain(envName)
 	if err != nil {
 		return nil, err
 	}
-	return provider.ListOrDescribe(ctx, p, provider.ResolvedPrefix(envCfg.ToProviderConfig()))
+	layers := envCfg.Layers()
+	if len(chain) == 1 && len(layers) == 1 {
+		layer := layers[0]
+		p, err := NewProvider(envName, layer, globalCfg)
+		if err != nil {
+			return nil, err
+		}
+		records, err := provider.ListOrDescribe(ctx, p, provider.ResolvedPrefix(layer.ToProviderConfig()))
+		if err != nil {
+			return nil, err
+		}
+		if envCfg.resolvesRefs() {
+			if err := newRefResolver(ctx, globalCfg).ResolveRecords(ctx, records, nil); err != nil {
+				return nil, fmt.Errorf("env %q: %w", envName, err)
+			}
+		}
+		return mapRecords(envName, envCfg.Mapping, records)
+	}
+	// Merge the furthest ancestor first so nearer envs and later sources win.
+	merged := map[string]provider.SecretRecord{}
+	// literal holds keys last set by an env with resolve_refs: false.
+	literal := map[string]bool{}
+	for i := len(chain) - 1; i >= 0; i-- {
+		env := projectCfg.Envs[chain[i]]
+		for _, layer := range env.Layers() {
+			p, err := NewProvider(chain[i], layer, globalCfg)
+			if err != nil {
+				return nil, err
+			}
+			records, err := provider.ListOrDescribe(ctx, p, provider.ResolvedPrefix(layer.ToProviderConfig()))
+			if err != nil {
+				return nil, fmt.Errorf("env %s source %s: %w", chain[i], layer.SourceLabel(), err)
+			}
+			records, err = mapRecords(chain[i], env.Mapping, records)
+			if err != nil {
+				return nil, err
+			}
+			for k, rec := range records {
+				rec.Source = layer.SourceLabel()
+				merged[k] = rec
+				literal[k] = !env.resolvesRefs()
+			}
+		}
+	}
+	isLiteral := func(k string) bool { return literal[k] }
+	if err := newRefResolver(ctx, globalCfg).ResolveRecords(ctx, merged, isLiteral); err != nil {
+		return nil, fmt.Errorf("env %q: %w", envName, err)
+	}
+	return merged, nil
+}
+
+// mapRecords renames records from provider keys to env var names.
+func mapRecords(envName string, mapping KeyMapping, records map[string]provider.SecretRecord) (map[string]provider.SecretRecord, error) {
+	if mapping.IsZero() {
+		return records, nil
+	}
+	keys := make([]string, 0, len(records))
+	for k := range records {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make(map[string]provider.SecretRecord, len(records))
+	from := make(map[string]string, len(records))
+	for _, k := range keys {
+		name := mapping.EnvName(k)
+		if prev, ok := from[name]; ok {
+			return nil, fmt.Errorf("env %q: provider keys %s and %s both map to %s", envName, prev, k, name)
+		}
+		from[name] = k
+		out[name] = records[k]
+	}
+	return out, nil
+}
+
+// envWriter addresses the layer an env's writes go to. Its provider and the
+// keys it already holds are resolved once, so commands that touch many keys
+// pay for instantiating and listing the provider only once.
+type envWriter struct {
+	p       provider.Provider
+	target  EnvConfig
+	mapping KeyMapping
+	// existing holds the target's provider keys; it is only listed when the
+	// env maps keys.
+	existing []string
+}
+
+func openEnvWriter(ctx context.Context, projectCfg ProjectConfig, globalCfg GlobalConfig, envName string) (*envWriter, error) {
+	env, target, err := envWriteTarget(projectCfg, envName)
+	if err != nil {
+		return nil, err
+	}
+	p, err := NewProvider(envName, target, globalCfg)
+	if err != nil {
+		return nil, err
+	}
+	w := &envWriter{p: p, target: target, mapping: env.Mapping}
+	if !w.mapping.IsZero() {
+		existing, err := p.List(ctx, provider.ResolvedPrefix(target.ToProviderConfig()))
+		if err != nil {
+			return nil, err
+		}
+		for k := range existing {
+			w.existing = append(w.existing, k)
+		}
+	}
+	return w, nil
+}
+
+// key maps an env var name back to the full key stored in the provider, so
+// set, delete and history address the same secret that run injects.
+func (w *envWriter) key(name string) string {
+	return provider.ApplyPrefix(w.target.ToProviderConfig(), w.mapping.ProviderKey(name, w.existing))
+}
+
+// Set writes value under name and remembers the provider key it used.
+func (w *envWriter) Set(ctx context.Context, name, value string) error {
+	if err := w.p.Set(ctx, w.key(name), value); err != nil {
+		return err
+	}
+	if !w.mapping.IsZero() {
+		if key := w.mapping.ProviderKey(name, w.existing); !slices.Contains(w.existing, key) {
+			w.existing = append(w.existing, key)
+		}
+	}
+	return nil
+}
+
+// envWriteTarget looks up envName and the layer that writes to it go to.
+func envWriteTarget(projectCfg ProjectConfig, envName string) (EnvConfig, EnvConfig, error) {
+	envCfg, ok := projectCfg.Envs[envName]
+	if !ok {
+		return EnvConfig{}, EnvConfig{}, fmt.Errorf("env %q not found in project config", envName)
+	}
+	target, ok := envCfg.WriteTarget()
+	if !ok {
+		return EnvConfig{}, EnvConfig{}, fmt.Errorf("env %q has no writable layer; it only extends %q, so give it a provider or sources of its own", envName, envCfg.Extends)
+	}
+	return envCfg, target, nil
+}
+
+// RequireCapabilities instantiates the env's providers and fails fast if any
+// lacks one of want. CapRead is checked on every layer the env reads from,
+// including inherited ones; other capabilities on the layer writes go to.
+func RequireCapabilities(projectCfg ProjectConfig, globalCfg GlobalConfig, envName string, want ...provider.Capability) error {
+	if _, ok := projectCfg.Envs[envName]; !ok {
+		return fmt.Errorf("env %q not found in project config", envName)
+	}
+	var read, write []provider.Capability
+	for _, c := range want {
+		if c == provider.CapRead {
+			read = append(read, c)
+		} else {
+			write = append(write, c)
+		}
+	}
+	if len(read) > 0 {
+		chain, err := projectCfg.ExtendsChain(envName)
+		if err != nil {
+			return err
+		}
+		for _, name := range chain {
+			for _, layer := range projectCfg.Envs[name].Layers() {
+				p, err := NewProvider(name, layer, globalCfg)
+				if err != nil {
+					return err
+				}
+				if err := provider.RequireCapabilities(p, layer.GetProvider(), read...); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if len(write) == 0 {
+		return nil
+	}
+	_, target, err := envWriteTarget(projectCfg, envName)
+	if err != nil {
+		return err
+	}
+	p, err := NewProvider(envName, target, globalCfg)
+	if err != nil {
+		return err
+	}
+	return provider.RequireCapabilities(p, target.GetProvider(), write...)
 }
 
 func FetchSecret(ctx context.Context, projectCfg ProjectConfig, globalCfg GlobalConfig, envName, key string) (string, error) {
@@ -73,38 +320,69 @@ func FetchSecret(ctx context.Context, projectCfg ProjectConfig, globalCfg Global
 	if !ok {
 		return "", fmt.Errorf("env %q not found in project config", envName)
 	}
-	p, err := NewProvider(envName, envCfg, globalCfg)
+	layers := envCfg.Layers()
+	if len(layers) != 1 || envCfg.Extends != "" || !envCfg.Mapping.IsZero() {
+		records, err := CollectEnvWithMetadata(ctx, projectCfg, globalCfg, envName)
+		if err != nil {
+			return "", err
+		}
+		rec, ok := records[key]
+		if !ok {
+			return "", fmt.Errorf("secret %s not found in env %q", key, envName)
+		}
+		return rec.Value, nil
+	}
+	layer := layers[0]
+	p, err := NewProvider(envName, layer, globalCfg)
 	if err != nil {
 		return "", err
 	}
-	return p.Get(ctx, provider.ApplyPrefix(envCfg.ToProviderConfig(), key))
+	value, err := p.Get(ctx, provider.ApplyPrefix(layer.ToProviderConfig(), key))
+	if err != nil || !envCfg.resolvesRefs() {
+		return value, err
+	}
+	return newRefResolver(ctx, globalCfg).Resolve(ctx, value)
 }
 
 func WriteSecret(ctx context.Context, projectCfg ProjectConfig, globalCfg GlobalConfig, envName, key, value string) error {
-	envCfg, ok := projectCfg.Envs[envName]
-	if !ok {
-		return fmt.Errorf("env %q not found in project config", envName)
-	}
-	p, err := NewProvider(envName, envCfg, globalCfg)
+	w, err := openEnvWriter(ctx, projectCfg, globalCfg, envName)
 	if err != nil {
 		return err
 	}
-	return p.Set(ctx, provider.ApplyPrefix(envCfg.ToProviderConfig(), key), value)
+	return w.Set(ctx, key, value)
 }
 
 func DeleteSecret(ctx context.Context, projectCfg ProjectConfig, globalCfg GlobalConfig, envName, key string) error {
-	envCfg, ok := projectCfg.Envs[envName]
+	w, err := openEnvWriter(ctx, projectCfg, globalCfg, envName)
+	if err != nil {
+		return err
+	}
+	if err := provider.RequireCapabilities(w.p, w.target.GetProvider(), provider.CapDelete); err != nil {
+		return err
+	}
+	return w.p.(provider.Deleter).Delete(ctx, w.key(key))
+}
+
+func SecretHistory(ctx context.Context, projectCfg ProjectConfig, globalCfg GlobalConfig, envName, key string) ([]provider.SecretVersion, error) {
+	w, err := openEnvWriter(ctx, projectCfg, globalCfg, envName)
+	if err != nil {
+		return nil, err
+	}
+	versioner, ok := w.p.(provider.Versioner)
 	if !ok {
-		return fmt.Errorf("env %q not found in project config", envName)
+		return nil, fmt.Errorf("provider %s does not support version history", w.target.GetProvider())
 	}
-	p, err := NewProvider(envName, envCfg, globalCfg)
+	return versioner.History(ctx, w.key(key))
+}
+
+func RollbackSecret(ctx context.Context, projectCfg ProjectConfig, globalCfg GlobalConfig, envName, key string, version int) error {
+	w, err := openEnvWriter(ctx, projectCfg, globalCfg, envName)
 	if err != nil {
 		return err
 	}
-	if deleter, ok := p.(interface {
-		Delete(ctx context.Context, name string) error
-	}); ok {
-		return deleter.Delete(ctx, provider.ApplyPrefix(envCfg.ToProviderConfig(), key))
+	versioner, ok := w.p.(provider.Versioner)
+	if !ok {
+		return fmt.Errorf("provider %s does not support version history", w.target.GetProvider())
 	}
-	return fmt.Errorf("provider %s does not support delete", envCfg.GetProvider())
+	return versioner.Rollback(ctx, w.key(key), version)
 }
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/binsquare/envmap/provider"
+)
+
+func TestCollectEnvLayersSources(t *testing.T) {
+	projectCfg, globalCfg := localTestConfig(t)
+	ctx := context.Background()
+	shared := EnvConfig{Provider: "local", Prefix: "shared/"}
+	overrides := EnvConfig{Provider: "local", Prefix: "me/"}
+	projectCfg.Envs["shared"] = shared
+	projectCfg.Envs["me"] = overrides
+	projectCfg.Envs["layered"] = EnvConfig{Sources: []SourceConfig{
+		{Provider: "local", Prefix: "shared/"},
+		{Provider: "local", Prefix: "me/"},
+	}}
+	if err := projectCfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for env, kv := range map[string][2]string{
+		"shared": {"DB_HOST", "db.internal"},
+		"me":     {"LOG_LEVEL", "debug"},
+	} {
+		if err := WriteSecret(ctx, projectCfg, globalCfg, env, kv[0], kv[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := WriteSecret(ctx, projectCfg, globalCfg, "shared", "LOG_LEVEL", "info"); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := CollectEnvWithMetadata(ctx, projectCfg, globalCfg, "layered")
+	if err != nil {
+		t.Fatalf("CollectEnvWithMetadata: %v", err)
+	}
+	if rec := records["LOG_LEVEL"]; rec.Value != "debug" || rec.Source != "local:me/" {
+		t.Errorf("LOG_LEVEL = %+v, want debug from local:me/", rec)
+	}
+	if rec := records["DB_HOST"]; rec.Value != "db.internal" || rec.Source != "local:shared/" {
+		t.Errorf("DB_HOST = %+v, want db.internal from local:shared/", rec)
+	}
+
+	// Writes land in the highest-precedence source.
+	if err := WriteSecret(ctx, projectCfg, globalCfg, "layered", "DB_HOST", "localhost"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := FetchSecret(ctx, projectCfg, globalCfg, "layered", "DB_HOST")
+	if err != nil || got != "localhost" {
+		t.Errorf("FetchSecret(DB_HOST) = %q, %v; want localhost", got, err)
+	}
+	if got, _ := FetchSecret(ctx, projectCfg, globalCfg, "shared", "DB_HOST"); got != "db.internal" {
+		t.Errorf("shared DB_HOST = %q, want unchanged", got)
+	}
+}
+
+func TestCollectEnvSingleSource(t *testing.T) {
+	projectCfg, globalCfg := localTestConfig(t)
+	ctx := context.Background()
+	projectCfg.Envs["single"] = EnvConfig{Sources: []SourceConfig{{Provider: "local", Prefix: "demo/single/"}}}
+	if err := projectCfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteSecret(ctx, projectCfg, globalCfg, "single", "API_KEY", "abc"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := CollectEnv(ctx, projectCfg, globalCfg, "single")
+	if err != nil {
+		t.Fatalf("CollectEnv: %v", err)
+	}
+	if got["API_KEY"] != "abc" || len(got) != 1 {
+		t.Errorf("single env = %v, want API_KEY=abc", got)
+	}
+	if v, err := FetchSecret(ctx, projectCfg, globalCfg, "single", "API_KEY"); err != nil || v != "abc" {
+		t.Errorf("FetchSecret(single, API_KEY) = %q, %v; want abc", v, err)
+	}
+	if _, err := FetchSecret(ctx, projectCfg, globalCfg, "dev", "API_KEY"); err == nil {
+		t.Error("FetchSecret read API_KEY outside the source's prefix")
+	}
+}
+
+func TestValidateSources(t *testing.T) {
+	cfg := ProjectConfig{Project: "x", DefaultEnv: "dev", Envs: map[string]EnvConfig{
+		"dev": {Provider: "a", Sources: []SourceConfig{{Provider: "b"}}},
+	}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate accepted provider together with sources")
+	}
+	cfg.Envs["dev"] = EnvConfig{Sources: []SourceConfig{{Prefix: "x/"}}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate accepted source without provider")
+	}
+}
+
+// localTestConfig returns a project with a single dev env backed by a fresh
+// local-file store.
+func localTestConfig(t *testing.T) (ProjectConfig, GlobalConfig) {
+	t.Helper()
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "key")
+	if err := provider.GenerateKeyFile(keyPath); err != nil {
+		t.Fatal(err)
+	}
+	globalCfg := GlobalConfig{Providers: map[string]provider.ProviderConfig{
+		"local": {
+			Type:       "local-file",
+			Path:       filepath.Join(dir, "secrets.db"),
+			Encryption: &provider.EncryptionConfig{KeyFile: keyPath},
+		},
+	}}
+	projectCfg := ProjectConfig{
+		Project:    "demo",
+		DefaultEnv: "dev",
+		Envs:       map[string]EnvConfig{"dev": {Provider: "local", Prefix: "demo/dev/"}},
+	}
+	return projectCfg, globalCfg
+}
+
+func TestCollectEnvExtends(t *testing.T) {
+	projectCfg, globalCfg := localTestConfig(t)
+	ctx := context.Background()
+	projectCfg.Envs["base"] = EnvConfig{Provider: "local", Prefix: "demo/base/"}
+	projectCfg.Envs["staging"] = EnvConfig{Provider: "local", Prefix: "demo/staging/", Extends: "base"}
+	projectCfg.Envs["preview"] = EnvConfig{Extends: "staging"}
+	if err := projectCfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []struct{ env, key, value string }{
+		{"base", "DB_HOST", "db.internal"},
+		{"base", "REPLICAS", "1"},
+		{"staging", "REPLICAS", "3"},
+	} {
+		if err := WriteSecret(ctx, projectCfg, globalCfg, s.env, s.key, s.value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := CollectEnv(ctx, projectCfg, globalCfg, "preview")
+	if err != nil {
+		t.Fatalf("CollectEnv: %v", err)
+	}
+	if got["DB_HOST"] != "db.internal" || got["REPLICAS"] != "3" || len(got) != 2 {
+		t.Errorf("preview env = %v, want DB_HOST inherited and REPLICAS from staging", got)
+	}
+	records, err := CollectEnvWithMetadata(ctx, projectCfg, globalCfg, "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src := records["DB_HOST"].Source; src != "local:demo/base/" {
+		t.Errorf("DB_HOST source = %q, want local:demo/base/", src)
+	}
+	if v, err := FetchSecret(ctx, projectCfg, globalCfg, "staging", "DB_HOST"); err != nil || v != "db.internal" {
+		t.Errorf("FetchSecret(staging, DB_HOST) = %q, %v", v, err)
+	}
+
+	// preview has no layer of its own: it can be read but not written.
+	if err := RequireCapabilities(projectCfg, globalCfg, "preview", provider.CapRead); err != nil {
+		t.Errorf("RequireCapabilities(preview, read) = %v", err)
+	}
+	if err := WriteSecret(ctx, projectCfg, globalCfg, "preview", "X", "1"); err == nil || !strings.Contains(err.Error(), "no writable layer") {
+		t.Errorf("WriteSecret(preview) = %v, want no writable layer", err)
+	}
+	if err := RequireCapabilities(projectCfg, globalCfg, "preview", provider.CapWrite); err == nil || !strings.Contains(err.Error(), "no writable layer") {
+		t.Errorf("RequireCapabilities(preview, write) = %v, want no writable layer", err)
+	}
+}
+
+func TestExtendsChain(t *testing.T) {
+	cfg := ProjectConfig{Project: "x", DefaultEnv: "a", Envs: map[string]EnvConfig{
+		"a": {Provider: "p", Extends: "b"},
+		"b": {Provider: "p", Extends: "c"},
+		"c": {Provider: "p"},
+	}}
+	chain, err := cfg.ExtendsChain("a")
+	if err != nil || strings.Join(chain, ",") != "a,b,c" {
+		t.Errorf("ExtendsChain(a) = %v, %v; want a,b,c", chain, err)
+	}
+
+	cfg.Envs["c"] = EnvConfig{Provider: "p", Extends: "a"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("Validate error = %v, want cycle", err)
+	}
+	cfg.Envs["c"] = EnvConfig{Provider: "p", Extends: "missing"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "unknown env") {
+		t.Errorf("Validate error = %v, want unknown env", err)
+	}
+}
@@ -1,39 +1,351 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
 	"os"
 	"strings"
 )
 
+// dotEnvEntry is one item of a .env file in source order: an assignment, or
+// a blank, comment or bare-name line kept only so the file can be rewritten
+// without losing it.
+type dotEnvEntry struct {
+	// Key is empty for lines that assign nothing.
+	Key   string
+	Value string
+	// Export records a leading "export " on the assignment.
+	Export bool
+	// Comment is a trailing "# ..." after the value, if any.
+	Comment string
+	// Line is the 1-based line the entry starts on.
+	Line int
+	// Raw is the entry's source text without its final newline; quoted
+	// values may span several lines.
+	Raw string
+}
+
+// DotEnvError reports a syntax error in a .env file.
+type DotEnvError struct {
+	Path string
+	Line int
+	Msg  string
+}
+
+func (e *DotEnvError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.Path, e.Line, e.Msg)
+}
+
+// parseDotEnv reads a .env file into a map; later assignments win.
 func parseDotEnv(path string) (map[string]string, error) {
-	f, err := os.Open(path)
+	entries, err := readDotEnv(path)
+	if err != nil {
+		return nil, err
+	}
+	return dotEnvValues(entries), nil
+}
+
+// readDotEnv reads and parses a .env file, expanding references from the
+// file itself and then the process environment.
+func readDotEnv(path string) ([]dotEnvEntry, error) {
+	b, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("open %s: %w", path, err)
 	}
-	defer f.Close()
+	return parseDotEnvEntries(path, string(b), os.LookupEnv)
+}
 
+func dotEnvValues(entries []dotEnvEntry) map[string]string {
 	out := make(map[string]string)
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
+	for _, e := range entries {
+		if e.Key != "" {
+			out[e.Key] = e.Value
+		}
+	}
+	return out
+}
+
+// dotEnvKeys lists the assigned keys in order of first appearance.
+func dotEnvKeys(entries []dotEnvEntry) []string {
+	var keys []string
+	seen := map[string]bool{}
+	for _, e := range entries {
+		if e.Key != "" && !seen[e.Key] {
+			seen[e.Key] = true
+			keys = append(keys, e.Key)
+		}
+	}
+	return keys
+}
+
+// parseDotEnvEntries parses .env source following the docker compose dotenv
+// rules:
+//
+//   - blank lines and lines starting with # are comments;
+//   - an optional "export " prefix is ignored;
+//   - whitespace around the key and = is ignored;
+//   - 'single quoted' values are literal and may span lines;
+//   - "double quoted" values may span lines, understand \n \r \t \" \\ \$
+//     escapes and expand references;
+//   - unquoted values end at the line end or at a # preceded by whitespace,
+//     are trimmed and expand references;
+//   - references are $NAME, ${NAME}, ${NAME:-default} and ${NAME-default},
+//     looked up among earlier keys and then with lookup.
+//
+// A bare NAME without = is kept as a non-assigning entry. name is used in errors.
+func parseDotEnvEntries(name, src string, lookup func(string) (string, bool)) ([]dotEnvEntry, error) {
+	p := &dotEnvParser{name: name, src: src, line: 1, lookup: lookup, vars: map[string]string{}}
+	var entries []dotEnvEntry
+	for p.pos < len(p.src) {
+		e, err := p.entry()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+type dotEnvParser struct {
+	name   string
+	src    string
+	pos    int
+	line   int
+	lookup func(string) (string, bool)
+	vars   map[string]string
+}
+
+func (p *dotEnvParser) errorf(line int, format string, args ...any) error {
+	return &DotEnvError{Path: p.name, Line: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// lineEnd returns the index of the newline ending the line containing i, or len(src).
+func (p *dotEnvParser) lineEnd(i int) int {
+	if j := strings.IndexByte(p.src[i:], '\n'); j >= 0 {
+		return i + j
+	}
+	return len(p.src)
+}
+
+// finish records the entry spanning src[start:end] and moves past its newline.
+func (p *dotEnvParser) finish(e dotEnvEntry, start, end int) dotEnvEntry {
+	e.Raw = strings.TrimSuffix(p.src[start:end], "\r")
+	p.line += strings.Count(p.src[start:end], "\n")
+	p.pos = end
+	if p.pos < len(p.src) {
+		p.pos++
+		p.line++
+	}
+	return e
+}
+
+func (p *dotEnvParser) entry() (dotEnvEntry, error) {
+	start, line := p.pos, p.line
+	end := p.lineEnd(start)
+	e := dotEnvEntry{Line: line}
+
+	i := skipBlanks(p.src, start, end)
+	if i == end || p.src[i] == '#' || p.src[i] == '\r' && i+1 == end {
+		return p.finish(e, start, end), nil
+	}
+	if rest := p.src[i:end]; strings.HasPrefix(rest, "export ") || strings.HasPrefix(rest, "export\t") {
+		e.Export = true
+		i = skipBlanks(p.src, i+len("export"), end)
+	}
+	eq := strings.IndexByte(p.src[i:end], '=')
+	if eq < 0 {
+		bare := strings.TrimSpace(p.src[i:end])
+		if !validDotEnvKey(bare) {
+			return e, p.errorf(line, "expected KEY=VALUE, got %q", bare)
+		}
+		return p.finish(e, start, end), nil
+	}
+	key := strings.TrimSpace(p.src[i : i+eq])
+	if !validDotEnvKey(key) {
+		return e, p.errorf(line, "invalid key %q", key)
+	}
+	e.Key = key
+
+	valueStart := i + eq + 1
+	i = skipBlanks(p.src, valueStart, end)
+	var err error
+	switch {
+	case i < end && p.src[i] == '\'':
+		closing := strings.IndexByte(p.src[i+1:], '\'')
+		if closing < 0 {
+			return e, p.errorf(line, "unterminated single-quoted value for %s", key)
+		}
+		e.Value = p.src[i+1 : i+1+closing]
+		end, e.Comment, err = p.afterQuote(i+1+closing+1, line, key)
+	case i < end && p.src[i] == '"':
+		closing := -1
+		for j := i + 1; j < len(p.src); j++ {
+			if p.src[j] == '\\' {
+				j++
+			} else if p.src[j] == '"' {
+				closing = j
+				break
+			}
+		}
+		if closing < 0 {
+			return e, p.errorf(line, "unterminated double-quoted value for %s", key)
+		}
+		if e.Value, err = p.expand(p.src[i+1:closing], true, line); err != nil {
+			return e, err
+		}
+		end, e.Comment, err = p.afterQuote(closing+1, line, key)
+	default:
+		// A # only starts a comment after whitespace, so KEY=#x is "#x".
+		raw := p.src[valueStart:end]
+		for j := 1; j < len(raw); j++ {
+			if raw[j] == '#' && (raw[j-1] == ' ' || raw[j-1] == '\t') {
+				raw, e.Comment = raw[:j], strings.TrimSpace(raw[j:])
+				break
+			}
+		}
+		e.Value, err = p.expand(strings.TrimSpace(raw), false, line)
+	}
+	if err != nil {
+		return e, err
+	}
+	p.vars[key] = e.Value
+	return p.finish(e, start, end), nil
+}
+
+// afterQuote checks that only whitespace or a comment follows a closing
+// quote at i and returns the end of that line and the comment.
+func (p *dotEnvParser) afterQuote(i, line int, key string) (int, string, error) {
+	end := p.lineEnd(i)
+	rest := strings.TrimSpace(p.src[i:end])
+	if rest != "" && rest[0] != '#' {
+		return 0, "", p.errorf(line, "unexpected %q after quoted value for %s", rest, key)
+	}
+	return end, rest, nil
+}
+
+// expand resolves references in s, and escapes too when quoted.
+func (p *dotEnvParser) expand(s string, quoted bool, line int) (string, error) {
+	if !strings.ContainsAny(s, `$\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quoted && c == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '"', '\\', '$':
+				b.WriteByte(s[i])
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		if c != '$' || i+1 == len(s) {
+			b.WriteByte(c)
 			continue
 		}
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) != 2 {
+		if s[i+1] == '{' {
+			closing := strings.IndexByte(s[i:], '}')
+			if closing < 0 {
+				return "", p.errorf(line, "unterminated ${ in value")
+			}
+			b.WriteString(p.resolve(s[i+2 : i+closing]))
+			i += closing
 			continue
 		}
-		key := strings.TrimSpace(parts[0])
-		val := strings.TrimSpace(parts[1])
-		val = strings.Trim(val, `"'`)
-		if key != "" {
-			out[key] = val
+		n := 0
+		for i+1+n < len(s) && isNameByte(s[i+1+n], n == 0) {
+			n++
+		}
+		if n == 0 {
+			b.WriteByte(c)
+			continue
 		}
+		b.WriteString(p.resolve(s[i+1 : i+1+n]))
+		i += n
 	}
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("read %s: %w", path, err)
+	return b.String(), nil
+}
+
+// resolve evaluates the inside of ${...}: NAME, NAME:-default or NAME-default.
+func (p *dotEnvParser) resolve(ref string) string {
+	name, def, mode := ref, "", ""
+	if i := strings.Index(ref, ":-"); i >= 0 {
+		name, def, mode = ref[:i], ref[i+2:], ":-"
+	} else if i := strings.IndexByte(ref, '-'); i >= 0 {
+		name, def, mode = ref[:i], ref[i+1:], "-"
+	}
+	value, ok := p.vars[name]
+	if !ok && p.lookup != nil {
+		value, ok = p.lookup(name)
+	}
+	if mode == ":-" && value == "" || mode == "-" && !ok {
+		return def
+	}
+	return value
+}
+
+func skipBlanks(s string, i, end int) int {
+	for i < end && (s[i] == ' ' || s[i] == '\t') {
+		i++
+	}
+	return i
+}
+
+func isNameByte(c byte, first bool) bool {
+	return c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || !first && c >= '0' && c <= '9'
+}
+
+// validDotEnvKey accepts the key characters docker compose does.
+func validDotEnvKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if c := key[i]; !isNameByte(c, false) && c != '.' && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// formatDotEnvLine renders one KEY=VALUE assignment that parseDotEnvEntries
+// (and docker compose) read back as exactly value.
+func formatDotEnvLine(key, value string) string {
+	return key + "=" + quoteDotEnvValue(value)
+}
+
+// quoteDotEnvValue leaves plain values bare and double-quotes anything the
+// unquoted form would alter: whitespace, comments, quotes, escapes,
+// references and line breaks.
+func quoteDotEnvValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\r\n#'\"\\$`") {
+		return value
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '"', '\\', '$':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
 	}
-	return out, nil
+	b.WriteByte('"')
+	return b.String()
 }
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -81,3 +84,171 @@ func TestParseDotEnvNotFound(t *testing.T) {
 		t.Error("expected error for missing file")
 	}
 }
+
+func TestParseDotEnvEntries(t *testing.T) {
+	src := "# header\n" +
+		"export TOKEN=abc\n" +
+		"PLAIN = value with spaces   # trailing comment\n" +
+		"HASH=a#b\n" +
+		"LEADING_HASH=#not-a-comment\n" +
+		"SINGLE='literal $TOKEN \\n'\n" +
+		"DOUBLE=\"line1\\nline2\\t\\\"q\\\" \\$TOKEN\"\n" +
+		"MULTI=\"first\n" +
+		"second\"\n" +
+		"CERT='-----BEGIN-----\n" +
+		"abc\n" +
+		"-----END-----' # pem\n" +
+		"REF=${TOKEN}-$TOKEN\n" +
+		"HOSTREF=${HOST_ONLY}\n" +
+		"DEFAULT=${MISSING:-fallback}\n" +
+		"EMPTY=\n" +
+		"EMPTYDEF=${EMPTY:-used}${EMPTY-unused}\n" +
+		"BARE\n" +
+		"DOLLAR=cost $ 5\r\n" +
+		"LAST=end"
+	lookup := func(name string) (string, bool) {
+		if name == "HOST_ONLY" {
+			return "from-host", true
+		}
+		return "", false
+	}
+	entries, err := parseDotEnvEntries(".env", src, lookup)
+	if err != nil {
+		t.Fatalf("parseDotEnvEntries: %v", err)
+	}
+	got := dotEnvValues(entries)
+	want := map[string]string{
+		"TOKEN":        "abc",
+		"PLAIN":        "value with spaces",
+		"HASH":         "a#b",
+		"LEADING_HASH": "#not-a-comment",
+		"SINGLE":       `literal $TOKEN \n`,
+		"DOUBLE":       "line1\nline2\t\"q\" $TOKEN",
+		"MULTI":        "first\nsecond",
+		"CERT":         "-----BEGIN-----\nabc\n-----END-----",
+		"REF":          "abc-abc",
+		"HOSTREF":      "from-host",
+		"DEFAULT":      "fallback",
+		"EMPTYDEF":     "used",
+		"EMPTY":        "",
+		"DOLLAR":       "cost $ 5",
+		"LAST":         "end",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d keys, want %d: %v", len(got), len(want), got)
+	}
+
+	keys := dotEnvKeys(entries)
+	if keys[0] != "TOKEN" || keys[len(keys)-1] != "LAST" {
+		t.Errorf("keys out of order: %v", keys)
+	}
+	// Every source line is accounted for, in order.
+	var lines []string
+	for _, e := range entries {
+		lines = append(lines, e.Raw)
+	}
+	if rebuilt := strings.Join(lines, "\n"); rebuilt != strings.ReplaceAll(src, "\r\n", "\n") {
+		t.Errorf("entries do not reproduce the source:\n%s", rebuilt)
+	}
+	for _, e := range entries {
+		if e.Key == "CERT" && e.Line != 10 {
+			t.Errorf("CERT starts on line %d, want 10", e.Line)
+		}
+		if e.Key == "REF" && e.Line != 13 {
+			t.Errorf("REF starts on line %d, want 13", e.Line)
+		}
+		if e.Key == "TOKEN" && !e.Export {
+			t.Error("export prefix not recorded")
+		}
+	}
+}
+
+func TestParseDotEnvEntriesErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		line int
+		msg  string
+	}{
+		{"A=1\nB=\"open\nC=3\n", 2, "unterminated double-quoted"},
+		{"A=1\n\nB='open\n", 3, "unterminated single-quoted"},
+		{"A=\"x\" y\n", 1, "after quoted value"},
+		{"A=1\nnot a key\n", 2, "expected KEY=VALUE"},
+		{"BAD KEY=1\n", 1, "invalid key"},
+		{"A=${OPEN\n", 1, "unterminated ${"},
+	}
+	for _, tt := range tests {
+		_, err := parseDotEnvEntries(".env", tt.src, nil)
+		var dErr *DotEnvError
+		if !errors.As(err, &dErr) {
+			t.Errorf("%q: expected *DotEnvError, got %v", tt.src, err)
+			continue
+		}
+		if dErr.Line != tt.line || !strings.Contains(dErr.Msg, tt.msg) {
+			t.Errorf("%q: got %v, want line %d containing %q", tt.src, err, tt.line, tt.msg)
+		}
+	}
+}
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// trickyValues exercise every character class the writers must escape.
+var trickyValues = map[string]string{
+	"PLAIN":      "simple-value_1.2:3/4@5+6",
+	"SPACES":     "hello world",
+	"LEADING":    "  padded  ",
+	"HASH":       "abc #def",
+	"HASH_TIGHT": "abc#def",
+	"EQUALS":     "a=b=c",
+	"SINGLE":     "it's",
+	"DOUBLE":     `say "hi"`,
+	"BACKSLASH":  `C:\path\new`,
+	"DOLLAR":     "$HOME and ${USER}",
+	"BACKTICK":   "`id`",
+	"NEWLINES":   "line1\nline2\r\n",
+	"TAB":        "a\tb",
+	"EMPTY":      "",
+	"UNICODE":    "héllo ✓",
+	"QUOTES":     "it\u2019s \u2018a\u2019 \u201ab\u201b",
+}
+
+// checkGolden compares got with testdata/name, rewriting it under -update.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden file (run go test -update to create it): %v", err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("%s mismatch:\n--- got\n%s\n--- want\n%s", path, got, want)
+	}
+}
+
+func TestFormatDotEnvGolden(t *testing.T) {
+	var b strings.Builder
+	for _, k := range sortedKeys(trickyValues) {
+		b.WriteString(formatDotEnvLine(k, trickyValues[k]) + "\n")
+	}
+	checkGolden(t, "tricky.env", []byte(b.String()))
+
+	entries, err := parseDotEnvEntries("tricky.env", b.String(), nil)
+	if err != nil {
+		t.Fatalf("parse written file: %v", err)
+	}
+	got := dotEnvValues(entries)
+	for k, v := range trickyValues {
+		if got[k] != v {
+			t.Errorf("%s round-tripped to %q, want %q", k, got[k], v)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ExportFormat renders secrets for one consumer of `envmap export`.
+type ExportFormat struct {
+	// Name is the value accepted by --format.
+	Name string
+	// Description is shown in the export command's help.
+	Description string
+	// Write renders env to w.
+	Write func(w io.Writer, env map[string]string, opts ExportOptions) error
+}
+
+// ExportOptions carries the settings some formats need.
+type ExportOptions struct {
+	// Name is the object name for manifest formats; defaults to the env name.
+	Name string
+	// Namespace is the Kubernetes namespace, omitted when empty.
+	Namespace string
+}
+
+var exportFormats = map[string]ExportFormat{}
+
+// RegisterExportFormat adds a format to `envmap export`. It is meant to be
+// called from init functions and panics on duplicate names.
+func RegisterExportFormat(f ExportFormat) {
+	if f.Name == "" || f.Write == nil {
+		panic("export format needs a name and a writer")
+	}
+	if _, exists := exportFormats[f.Name]; exists {
+		panic(fmt.Sprintf("export format %q already registered", f.Name))
+	}
+	exportFormats[f.Name] = f
+}
+
+// ExportFormats returns the registered formats sorted by name.
+func ExportFormats() []ExportFormat {
+	formats := make([]ExportFormat, 0, len(exportFormats))
+	for _, f := range exportFormats {
+		formats = append(formats, f)
+	}
+	sort.Slice(formats, func(i, j int) bool { return formats[i].Name < formats[j].Name })
+	return formats
+}
+
+func lookupExportFormat(name string) (ExportFormat, error) {
+	if name == "" {
+		name = "plain"
+	}
+	if f, ok := exportFormats[name]; ok {
+		return f, nil
+	}
+	names := make([]string, 0, len(exportFormats))
+	for _, f := range ExportFormats() {
+		names = append(names, f.Name)
+	}
+	return ExportFormat{}, fmt.Errorf("unknown format %q (use %s)", name, strings.Join(names, ", "))
+}
+
+func init() {
+	RegisterExportFormat(ExportFormat{Name: "plain", Description: "KEY='VAL' lines, shell-quoted for eval or direnv", Write: writePlainExport})
+	for _, shell := range []string{"bash", "zsh"} {
+		RegisterExportFormat(ExportFormat{Name: shell, Description: "export KEY='VAL' lines", Write: writeShellExport})
+	}
+	RegisterExportFormat(ExportFormat{Name: "fish", Description: "set -gx KEY 'VAL' lines", Write: writeFishExport})
+	RegisterExportFormat(ExportFormat{Name: "powershell", Description: "$env:KEY = 'VAL' lines", Write: writePowerShellExport})
+	RegisterExportFormat(ExportFormat{Name: "dotenv", Description: ".env file, quoted where needed", Write: writeDotEnvExport})
+	RegisterExportFormat(ExportFormat{Name: "json", Description: "JSON object, suitable for tooling", Write: writeJSONExport})
+	RegisterExportFormat(ExportFormat{Name: "yaml", Description: "YAML mapping", Write: writeYAMLExport})
+	RegisterExportFormat(ExportFormat{Name: "docker", Description: "file for docker run --env-file (single-line values only)", Write: writeDockerExport})
+	RegisterExportFormat(ExportFormat{Name: "kubernetes", Description: "Kubernetes Secret manifest (--name, --namespace)", Write: writeKubernetesExport})
+	RegisterExportFormat(ExportFormat{Name: "systemd", Description: "systemd EnvironmentFile", Write: writeSystemdExport})
+	RegisterExportFormat(ExportFormat{Name: "github", Description: "GitHub Actions $GITHUB_ENV entries", Write: writeGitHubExport})
+}
+
+// writePlainExport writes KEY='value' lines that a POSIX shell can eval.
+// Keys that are not valid shell variable names are skipped with a warning.
+func writePlainExport(w io.Writer, env map[string]string, _ ExportOptions) error {
+	return writeLines(w, shellNames(env), func(k string) string {
+		return k + "=" + shellQuote(env[k])
+	})
+}
+
+func writeShellExport(w io.Writer, env map[string]string, _ ExportOptions) error {
+	return writeLines(w, shellNames(env), func(k string) string {
+		return "export " + k + "=" + shellQuote(env[k])
+	})
+}
+
+func writeFishExport(w io.Writer, env map[string]string, _ ExportOptions) error {
+	return writeLines(w, shellNames(env), func(k string) string {
+		return "set -gx " + k + " " + fishQuote(env[k])
+	})
+}
+
+// fishQuote single-quotes s for fish, where only \' and \\ are escapes.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// powerShellQuote doubles every rune PowerShell accepts as a single quote,
+// which includes the typographic ones U+2018 to U+201B.
+var powerShellQuote = strings.NewReplacer("'", "''", "\u2018", "\u2018\u2018", "\u2019", "\u2019\u2019", "\u201a", "\u201a\u201a", "\u201b", "\u201b\u201b")
+
+func writePowerShellExport(w io.Writer, env map[string]string, _ ExportOptions) error {
+	return writeLines(w, shellNames(env), func(k string) string {
+		return "$env:" + k + " = '" + powerShellQuote.Replace(env[k]) + "'"
+	})
+}
+
+func writeDotEnvExport(w io.Writer, env map[string]string, _ ExportOptions) error {
+	var keys []string
+	for _, k := range sortedKeys(env) {
+		if !validDotEnvKey(k) {
+			fmt.Fprintf(os.Stderr, "envmap: skipping %s: not a valid .env key\n", k)
+			continue
+		}
+		keys = append(keys, k)
+	}
+	return writeLines(w, keys, func(k string) string { return formatDotEnvLine(k, env[k]) })
+}
+
+func writeJSONExport(w io.Writer, env map[string]string, _ ExportOptions) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(env)
+}
+
+func writeYAMLExport(w io.Writer, env map[string]string, _ ExportOptions) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(env); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// writeDockerExport writes docker's env-file format, which takes everything
+// after = literally and has no way to express a line break.
+func writeDockerExport(w io.Writer, env map[string]string, _ ExportOptions) error {
+	keys := sortedKeys(env)
+	for _, k := range keys {
+		if strings.ContainsAny(env[k], "\r\n") {
+			return fmt.Errorf("%s: docker env files cannot hold multi-line values; use --format dotenv with compose's env_file instead", k)
+		}
+		if k == "" || strings.ContainsAny(k, "= \t#") {
+			return fmt.Errorf("%s: not a valid docker env-file key", k)
+		}
+	}
+	return writeLines(w, keys, func(k string) string { return k + "=" + env[k] })
+}
+
+type kubernetesSecret struct {
+	APIVersion string             `yaml:"apiVersion"`
+	Kind       string             `yaml:"kind"`
+	Metadata   kubernetesMetadata `yaml:"metadata"`
+	Type       string             `yaml:"type"`
+	Data       map[string]string  `yaml:"data"`
+}
+
+type kubernetesMetadata struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+func writeKubernetesExport(w io.Writer, env map[string]string, opts ExportOptions) error {
+	if opts.Name == "" {
+		return fmt.Errorf("kubernetes format needs a secret name (--name)")
+	}
+	secret := kubernetesSecret{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata:   kubernetesMetadata{Name: opts.Name, Namespace: opts.Namespace},
+		Type:       "Opaque",
+		Data:       map[string]string{},
+	}
+	for _, k := range sortedKeys(env) {
+		if !validKubernetesKey(k) {
+			fmt.Fprintf(os.Stderr, "envmap: skipping %s: not a valid Kubernetes secret key\n", k)
+			continue
+		}
+		secret.Data[k] = base64.StdEncoding.EncodeToString([]byte(env[k]))
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(secret); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// validKubernetesKey matches the keys a Secret's data may use: [-._a-zA-Z0-9]+.
+func validKubernetesKey(k string) bool {
+	if k == "" {
+		return false
+	}
+	for i := 0; i < len(k); i++ {
+		if c := k[i]; !isNameByte(c, false) && c != '-' && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// writeSystemdExport writes an EnvironmentFile: double-quoted values may span
+// lines and treat \, ", $ and ` as escapable.
+func writeSystemdExport(w io.Writer, env map[string]string, _ ExportOptions) error {
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "`", "\\`")
+	return writeLines(w, shellNames(env), func(k string) string {
+		return k + `="` + quote.Replace(env[k]) + `"`
+	})
+}
+
+// writeGitHubExport writes entries for $GITHUB_ENV using the heredoc form,
+// which carries any value, including line breaks, verbatim.
+func writeGitHubExport(w io.Writer, env map[string]string, _ ExportOptions) error {
+	return writeLines(w, shellNames(env), func(k string) string {
+		delim := gitHubDelimiter(env[k])
+		return k + "<<" + delim + "\n" + env[k] + "\n" + delim
+	})
+}
+
+// gitHubDelimiter picks a heredoc delimiter that does not occur as a line of value.
+func gitHubDelimiter(value string) string {
+	lines := map[string]bool{}
+	for _, line := range strings.Split(value, "\n") {
+		lines[strings.TrimSuffix(line, "\r")] = true
+	}
+	delim := "ENVMAP_EOF"
+	for n := 1; lines[delim]; n++ {
+		delim = fmt.Sprintf("ENVMAP_EOF_%d", n)
+	}
+	return delim
+}
+
+func writeLines(w io.Writer, keys []string, line func(string) string) error {
+	for _, k := range keys {
+		if _, err := io.WriteString(w, line(k)+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shellNames returns env's keys that are valid shell variable names, sorted,
+// warning about the rest.
+func shellNames(env map[string]string) []string {
+	var keys []string
+	for _, k := range sortedKeys(env) {
+		if !isShellName(k) {
+			fmt.Fprintf(os.Stderr, "envmap: skipping %s: not a valid shell variable name\n", k)
+			continue
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func sortedKeys(env map[string]string) []string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// isShellName reports whether s can be assigned as a shell variable.
+func isShellName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isNameByte(s[i], i == 0) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// exportInput is trickyValues plus a key no shell can assign.
+func exportInput() map[string]string {
+	env := map[string]string{"db/password": "skipped"}
+	for k, v := range trickyValues {
+		env[k] = v
+	}
+	return env
+}
+
+func TestExportFormatsGolden(t *testing.T) {
+	for _, f := range ExportFormats() {
+		t.Run(f.Name, func(t *testing.T) {
+			env := exportInput()
+			if f.Name == "docker" {
+				// docker env files have no quoting; only plain single-line values fit.
+				delete(env, "NEWLINES")
+				delete(env, "db/password")
+			}
+			var buf bytes.Buffer
+			if err := f.Write(&buf, env, ExportOptions{Name: "app-secrets", Namespace: "web"}); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			checkGolden(t, "export_"+f.Name+".golden", buf.Bytes())
+		})
+	}
+}
+
+func TestExportShellEval(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	keys := sortedKeys(trickyValues)
+	for _, name := range []string{"plain", "bash"} {
+		script := `eval "$(cat "$1")"; shift; for k in "$@"; do eval "printf '%s\0' \"\$$k\""; done`
+		args := append([]string{"-c", script, "sh", filepath.Join("testdata", "export_"+name+".golden")}, keys...)
+		out, err := exec.Command("sh", args...).Output()
+		if err != nil {
+			t.Fatalf("%s: eval in sh: %v", name, err)
+		}
+		values := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+		if len(values) != len(keys) {
+			t.Fatalf("%s: sh printed %d values, want %d", name, len(values), len(keys))
+		}
+		for i, k := range keys {
+			if values[i] != trickyValues[k] {
+				t.Errorf("%s: %s evaluated to %q, want %q", name, k, values[i], trickyValues[k])
+			}
+		}
+	}
+}
+
+func TestExportRoundTrips(t *testing.T) {
+	env := exportInput()
+	write := func(name string) string {
+		var buf bytes.Buffer
+		if err := exportFormats[name].Write(&buf, env, ExportOptions{Name: "app"}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return buf.String()
+	}
+
+	var fromJSON map[string]string
+	if err := json.Unmarshal([]byte(write("json")), &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+	var fromYAML map[string]string
+	if err := yaml.Unmarshal([]byte(write("yaml")), &fromYAML); err != nil {
+		t.Fatal(err)
+	}
+	var secret kubernetesSecret
+	if err := yaml.Unmarshal([]byte(write("kubernetes")), &secret); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := parseDotEnvEntries("dotenv", write("dotenv"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromDotEnv := dotEnvValues(entries)
+
+	for k, v := range trickyValues {
+		if fromJSON[k] != v {
+			t.Errorf("json %s = %q, want %q", k, fromJSON[k], v)
+		}
+		if fromYAML[k] != v {
+			t.Errorf("yaml %s = %q, want %q", k, fromYAML[k], v)
+		}
+		if fromDotEnv[k] != v {
+			t.Errorf("dotenv %s = %q, want %q", k, fromDotEnv[k], v)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(secret.Data[k])
+		if err != nil || string(decoded) != v {
+			t.Errorf("kubernetes %s = %q (%v), want %q", k, decoded, err, v)
+		}
+	}
+	if secret.Kind != "Secret" || secret.Metadata.Name != "app" {
+		t.Errorf("kubernetes manifest header = %+v", secret)
+	}
+	if _, ok := secret.Data["db/password"]; ok {
+		t.Error("kubernetes kept a key with a slash")
+	}
+}
+
+func TestExportDockerRejectsMultiline(t *testing.T) {
+	err := writeDockerExport(&bytes.Buffer{}, map[string]string{"CERT": "a\nb"}, ExportOptions{})
+	if err == nil || !strings.Contains(err.Error(), "CERT") {
+		t.Errorf("expected multi-line error naming CERT, got %v", err)
+	}
+}
+
+func TestGitHubDelimiter(t *testing.T) {
+	if d := gitHubDelimiter("plain"); d != "ENVMAP_EOF" {
+		t.Errorf("delimiter = %q", d)
+	}
+	if d := gitHubDelimiter("a\nENVMAP_EOF\nENVMAP_EOF_1\nb"); d != "ENVMAP_EOF_2" {
+		t.Errorf("delimiter avoiding value lines = %q", d)
+	}
+}
+
+func TestLookupExportFormatEmptyIsPlain(t *testing.T) {
+	f, err := lookupExportFormat("")
+	if err != nil || f.Name != "plain" {
+		t.Errorf(`lookupExportFormat("") = %q, %v; want plain`, f.Name, err)
+	}
+}
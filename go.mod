@@ -3,6 +3,7 @@ module github.com/binsquare/envmap
 go 1.25
 
 require (
+	filippo.io/age v1.2.1
 	github.com/1Password/connect-sdk-go v1.5.0
 	github.com/aws/aws-sdk-go-v2 v1.40.0
 	github.com/aws/aws-sdk-go-v2/config v1.26.0
@@ -12,6 +13,7 @@ require (
 	github.com/hashicorp/vault/api v1.22.0
 	github.com/spf13/cobra v1.7.0
 	golang.org/x/crypto v0.45.0
+	golang.org/x/sys v0.38.0
 	golang.org/x/term v0.37.0
 	google.golang.org/api v0.166.0
 	gopkg.in/yaml.v3 v3.0.1
@@ -70,7 +72,6 @@ require (
 	go.uber.org/atomic v1.9.0 // indirect
 	golang.org/x/net v0.47.0 // indirect
 	golang.org/x/oauth2 v0.17.0 // indirect
-	golang.org/x/sys v0.38.0 // indirect
 	golang.org/x/text v0.31.0 // indirect
 	golang.org/x/time v0.12.0 // indirect
 	google.golang.org/appengine v1.6.8 // indirect
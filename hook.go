@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// hookStateVar holds what the shell hook loaded, so the next prompt can
+// tell whether to refresh and exactly what to unload. It is a shell variable
+// that is not exported, since it records the values secrets shadowed; the
+// hook passes it to hook-env alone.
+const hookStateVar = "ENVMAP_HOOK_STATE"
+
+// hookState is stored base64-encoded JSON in hookStateVar.
+type hookState struct {
+	// Project is the .envmap.yaml the keys came from.
+	Project string   `json:"project"`
+	Env     string   `json:"env"`
+	Keys    []string `json:"keys"`
+	// Saved holds values the keys had before they were loaded.
+	Saved   map[string]string `json:"saved,omitempty"`
+	Expires int64             `json:"expires"`
+}
+
+func decodeHookState(s string) (hookState, bool) {
+	var st hookState
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(raw, &st) != nil {
+		return hookState{}, false
+	}
+	return st, true
+}
+
+func (st hookState) encode() string {
+	raw, _ := json.Marshal(st)
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+// hookDialect renders variable changes for one shell.
+type hookDialect struct {
+	set   func(k, v string) string
+	unset func(k string) string
+	// setLocal sets a shell variable without exporting it to child processes.
+	setLocal func(k, v string) string
+	// script is the prompt hook; %[1]s is the quoted envmap path, %[2]d the
+	// TTL in seconds and %[3]s the TTL flag value.
+	script string
+}
+
+var hookDialects = map[string]hookDialect{
+	"bash": {
+		set:      func(k, v string) string { return "export " + k + "=" + shellQuote(v) },
+		unset:    func(k string) string { return "unset " + k },
+		setLocal: func(k, v string) string { return k + "=" + shellQuote(v) + "; export -n " + k },
+		script: `_envmap_hook() {
+  local previous_exit_status=$?
+  if [[ "$PWD" != "${_envmap_pwd-}" || $SECONDS -ge ${_envmap_next:-0} ]]; then
+    _envmap_pwd=$PWD
+    _envmap_next=$((SECONDS + %[2]d))
+    eval "$(ENVMAP_HOOK_STATE="${ENVMAP_HOOK_STATE-}" %[1]s hook-env bash --ttl %[3]s)"
+  fi
+  return $previous_exit_status
+}
+if [[ ";${PROMPT_COMMAND[*]:-};" != *";_envmap_hook;"* ]]; then
+  PROMPT_COMMAND="_envmap_hook${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+fi
+`,
+	},
+	"zsh": {
+		set:      func(k, v string) string { return "export " + k + "=" + shellQuote(v) },
+		unset:    func(k string) string { return "unset " + k },
+		setLocal: func(k, v string) string { return "typeset -g +x " + k + "=" + shellQuote(v) },
+		script: `_envmap_hook() {
+  if [[ "$PWD" != "${_envmap_pwd-}" || $SECONDS -ge ${_envmap_next:-0} ]]; then
+    _envmap_pwd=$PWD
+    _envmap_next=$((SECONDS + %[2]d))
+    eval "$(ENVMAP_HOOK_STATE="${ENVMAP_HOOK_STATE-}" %[1]s hook-env zsh --ttl %[3]s)"
+  fi
+}
+typeset -ag precmd_functions
+if (( ! ${precmd_functions[(I)_envmap_hook]} )); then
+  precmd_functions=(_envmap_hook $precmd_functions)
+fi
+`,
+	},
+	"fish": {
+		set:      func(k, v string) string { return "set -gx " + k + " " + fishQuote(v) },
+		unset:    func(k string) string { return "set -e " + k },
+		setLocal: func(k, v string) string { return "set -gu " + k + " " + fishQuote(v) },
+		script: `function __envmap_hook --on-event fish_prompt
+    set -q __envmap_next; or set -g __envmap_next 0
+    set -l now (date +%%s)
+    if test "$PWD" != "$__envmap_pwd"; or test $now -ge $__envmap_next
+        set -g __envmap_pwd $PWD
+        set -g __envmap_next (math $now + %[2]d)
+        ENVMAP_HOOK_STATE="$ENVMAP_HOOK_STATE" %[1]s hook-env fish --ttl %[3]s | source
+    end
+end
+`,
+	},
+}
+
+// direnvLibrary defines use_envmap for direnv's stdlib; %[1]s is the quoted envmap path.
+const direnvLibrary = `# use_envmap [ENV]: load secrets from envmap into a direnv environment.
+# Save as ~/.config/direnv/lib/use_envmap.sh and add "use envmap" to .envrc.
+use_envmap() {
+  local config
+  config=$(find_up .envmap.yaml) || {
+    log_error "use_envmap: no .envmap.yaml found"
+    return 1
+  }
+  watch_file "$config"
+  local exports
+  if [[ -n "${1:-}" ]]; then
+    exports=$(%[1]s export --format bash --env "$1") || return 1
+  else
+    exports=$(%[1]s export --format bash) || return 1
+  fi
+  eval "$exports"
+}
+`
+
+func newHookCmd() *cobra.Command {
+	var ttl time.Duration
+	c := &cobra.Command{
+		Use:   "hook bash|zsh|fish|direnv",
+		Short: "Print a shell hook that loads secrets when entering a project",
+		Long: `Print a prompt hook that loads the default env's secrets when you enter a
+directory containing (or below) a .envmap.yaml, and unloads exactly those keys,
+restoring any values they shadowed, when you leave. Loaded secrets are reused
+for --ttl before being fetched again; nothing is written to disk.
+
+The hook never prompts: passphrase-encrypted stores must set encryption.key_env
+and have that variable set in the shell, or they fail to load with an error.
+
+Add one of these to your shell's rc file:
+  eval "$(envmap hook bash)"     # ~/.bashrc
+  eval "$(envmap hook zsh)"      # ~/.zshrc
+  envmap hook fish | source      # ~/.config/fish/config.fish
+
+For direnv, install the use_envmap helper and call it from .envrc:
+  envmap hook direnv > ~/.config/direnv/lib/use_envmap.sh
+  echo 'use envmap dev' >> .envrc && direnv allow`,
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{"bash", "zsh", "fish", "direnv"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			self, err := os.Executable()
+			if err != nil {
+				return fmt.Errorf("locate envmap binary: %w", err)
+			}
+			if args[0] == "direnv" {
+				fmt.Printf(direnvLibrary, shellQuote(self))
+				return nil
+			}
+			d, ok := hookDialects[args[0]]
+			if !ok {
+				return fmt.Errorf("unsupported shell %q (use bash, zsh, fish or direnv)", args[0])
+			}
+			if ttl < time.Second {
+				return fmt.Errorf("--ttl must be at least 1s")
+			}
+			fmt.Printf(d.script, shellQuote(self), int(ttl.Seconds()), ttl)
+			return nil
+		},
+	}
+	c.Flags().DurationVar(&ttl, "ttl", 5*time.Minute, "how long loaded secrets are reused before they are fetched again")
+	return c
+}
+
+// newHookEnvCmd is what the prompt hook runs: it prints the commands that
+// bring the shell's environment in line with the current directory.
+func newHookEnvCmd() *cobra.Command {
+	var ttl time.Duration
+	c := &cobra.Command{
+		Use:    "hook-env SHELL",
+		Hidden: true,
+		Args:   cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			d, ok := hookDialects[args[0]]
+			if !ok {
+				return fmt.Errorf("unsupported shell %q", args[0])
+			}
+			// Running from a prompt hook, a passphrase prompt would block the shell.
+			promptsDisabled = true
+			project, _ := FindProjectConfig("")
+			load := func(path string) (string, map[string]string, error) {
+				projectCfg, err := LoadProjectConfig(path)
+				if err != nil {
+					return "", nil, err
+				}
+				globalCfg, err := LoadGlobalConfig("")
+				if err != nil {
+					return "", nil, err
+				}
+				envName, err := ResolveEnv(projectCfg, "")
+				if err != nil {
+					return "", nil, err
+				}
+				secrets, err := CollectEnv(cmd.Context(), projectCfg, globalCfg, envName)
+				return envName, secrets, err
+			}
+			return hookEnv(os.Stdout, d, project, ttl, time.Now(), environMap(), load)
+		},
+	}
+	c.Flags().DurationVar(&ttl, "ttl", 5*time.Minute, "how long loaded secrets are reused")
+	return c
+}
+
+// hookEnv writes the shell commands that move from the state recorded in env
+// to the one wanted for project ("" outside any project). Secrets are only
+// fetched, through load, when entering a project or once the TTL has passed.
+func hookEnv(w io.Writer, d hookDialect, project string, ttl time.Duration, now time.Time, env map[string]string, load func(string) (string, map[string]string, error)) error {
+	prev, loaded := decodeHookState(env[hookStateVar])
+	if loaded && prev.Project == project && now.Unix() < prev.Expires {
+		return nil
+	}
+	if !loaded && project == "" {
+		return nil
+	}
+
+	// target is what the environment should look like for the touched keys.
+	target := map[string]*string{}
+	if loaded {
+		for _, k := range prev.Keys {
+			if v, ok := prev.Saved[k]; ok {
+				target[k] = &v
+			} else {
+				target[k] = nil
+			}
+		}
+	}
+	var next *hookState
+	if project != "" {
+		envName, secrets, err := load(project)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "envmap: %v\n", err)
+			// Keep what is loaded and try again on the next directory change
+			// or TTL, unless it belongs to a project being left.
+			if !loaded || prev.Project == project {
+				return nil
+			}
+			secrets = nil
+		}
+		if secrets != nil {
+			next = &hookState{Project: project, Env: envName, Saved: map[string]string{}, Expires: now.Add(ttl).Unix()}
+			for _, k := range sortedKeys(secrets) {
+				if !isShellName(k) {
+					continue
+				}
+				// Remember what the key holds once our previous values are gone.
+				if t, touched := target[k]; touched {
+					if t != nil {
+						next.Saved[k] = *t
+					}
+				} else if v, ok := env[k]; ok {
+					next.Saved[k] = v
+				}
+				v := secrets[k]
+				target[k] = &v
+				next.Keys = append(next.Keys, k)
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(target))
+	for k := range target {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var lines []string
+	for _, k := range keys {
+		current, present := env[k]
+		switch t := target[k]; {
+		case t == nil && present:
+			lines = append(lines, d.unset(k))
+		case t != nil && (!present || current != *t):
+			lines = append(lines, d.set(k, *t))
+		}
+	}
+	if next != nil {
+		lines = append(lines, d.setLocal(hookStateVar, next.encode()))
+		if !loaded || prev.Project != project {
+			fmt.Fprintf(os.Stderr, "envmap: loaded %d secrets from env %s\n", len(next.Keys), next.Env)
+		}
+	} else {
+		lines = append(lines, d.unset(hookStateVar))
+		fmt.Fprintf(os.Stderr, "envmap: unloaded %d secrets\n", len(prev.Keys))
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+func environMap() map[string]string {
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+	return env
+}
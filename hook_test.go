@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingDialect emits "set K=V" and "unset K" so tests can replay output.
+var recordingDialect = hookDialect{
+	set:      func(k, v string) string { return "set " + k + "=" + v },
+	unset:    func(k string) string { return "unset " + k },
+	setLocal: func(k, v string) string { return "set " + k + "=" + v },
+}
+
+// runHook calls hookEnv and applies its output to env, returning how often
+// load was called.
+func runHook(t *testing.T, env map[string]string, project string, now time.Time, secrets map[string]map[string]string) int {
+	t.Helper()
+	loads := 0
+	load := func(path string) (string, map[string]string, error) {
+		loads++
+		s, ok := secrets[path]
+		if !ok {
+			return "", nil, errors.New("unreachable provider")
+		}
+		return "dev", s, nil
+	}
+	var buf bytes.Buffer
+	if err := hookEnv(&buf, recordingDialect, project, time.Minute, now, env, load); err != nil {
+		t.Fatalf("hookEnv: %v", err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		switch {
+		case strings.HasPrefix(line, "set "):
+			k, v, _ := strings.Cut(strings.TrimPrefix(line, "set "), "=")
+			env[k] = v
+		case strings.HasPrefix(line, "unset "):
+			delete(env, strings.TrimPrefix(line, "unset "))
+		case line != "":
+			t.Fatalf("unexpected hook output %q", line)
+		}
+	}
+	return loads
+}
+
+func TestHookEnvLoadAndUnload(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	secrets := map[string]map[string]string{
+		"/a/.envmap.yaml": {"API_KEY": "a-key", "PATH_PREFIX": "x", "db/password": "skipped"},
+		"/b/.envmap.yaml": {"API_KEY": "b-key"},
+	}
+	env := map[string]string{"HOME": "/home/me", "PATH_PREFIX": "mine"}
+
+	if loads := runHook(t, env, "/a/.envmap.yaml", now, secrets); loads != 1 {
+		t.Fatalf("entering loaded %d times", loads)
+	}
+	if env["API_KEY"] != "a-key" || env["PATH_PREFIX"] != "x" || env[hookStateVar] == "" {
+		t.Fatalf("after entering: %v", env)
+	}
+	if _, ok := env["db/password"]; ok {
+		t.Error("invalid shell name exported")
+	}
+
+	// Within the TTL nothing is fetched or printed.
+	if loads := runHook(t, env, "/a/.envmap.yaml", now.Add(30*time.Second), secrets); loads != 0 {
+		t.Errorf("cached prompt loaded %d times", loads)
+	}
+
+	// After the TTL the secrets are refreshed and removed keys disappear.
+	secrets["/a/.envmap.yaml"] = map[string]string{"API_KEY": "rotated"}
+	if loads := runHook(t, env, "/a/.envmap.yaml", now.Add(2*time.Minute), secrets); loads != 1 {
+		t.Errorf("expired prompt loaded %d times", loads)
+	}
+	if env["API_KEY"] != "rotated" || env["PATH_PREFIX"] != "mine" {
+		t.Errorf("after refresh: %v", env)
+	}
+
+	// Switching projects swaps the keys.
+	runHook(t, env, "/b/.envmap.yaml", now.Add(3*time.Minute), secrets)
+	if env["API_KEY"] != "b-key" {
+		t.Errorf("after switching: %v", env)
+	}
+
+	// Leaving restores the shell exactly.
+	runHook(t, env, "", now.Add(4*time.Minute), secrets)
+	want := map[string]string{"HOME": "/home/me", "PATH_PREFIX": "mine"}
+	if fmt.Sprint(env) != fmt.Sprint(want) {
+		t.Errorf("after leaving: %v, want %v", env, want)
+	}
+}
+
+func TestHookEnvLoadFailure(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	secrets := map[string]map[string]string{"/a/.envmap.yaml": {"API_KEY": "a-key"}}
+	env := map[string]string{}
+	runHook(t, env, "/a/.envmap.yaml", now, secrets)
+
+	// A failed refresh keeps the loaded values.
+	delete(secrets, "/a/.envmap.yaml")
+	runHook(t, env, "/a/.envmap.yaml", now.Add(2*time.Minute), secrets)
+	if env["API_KEY"] != "a-key" {
+		t.Errorf("failed refresh dropped secrets: %v", env)
+	}
+
+	// Failing to load the next project still unloads the previous one.
+	runHook(t, env, "/broken/.envmap.yaml", now.Add(3*time.Minute), secrets)
+	if len(env) != 0 {
+		t.Errorf("secrets of the old project survived: %v", env)
+	}
+}
+
+func TestHookEnvBashOutput(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not installed")
+	}
+	load := func(string) (string, map[string]string, error) {
+		return "dev", map[string]string{"TOKEN": "it's $x"}, nil
+	}
+	var buf bytes.Buffer
+	if err := hookEnv(&buf, hookDialects["bash"], "/p/.envmap.yaml", time.Minute, time.Now(), map[string]string{}, load); err != nil {
+		t.Fatal(err)
+	}
+	// The state must reach the next hook-env but not other child processes.
+	script := buf.String() + `printf '%s|%s|' "$TOKEN" "${ENVMAP_HOOK_STATE:+set}"; printenv ENVMAP_HOOK_STATE || true`
+	out, err := exec.Command(bash, "-c", script).Output()
+	if err != nil {
+		t.Fatalf("eval hook output: %v\n%s", err, buf.String())
+	}
+	if string(out) != "it's $x|set|" {
+		t.Errorf("TOKEN, state and exported state = %q", out)
+	}
+}
@@ -85,8 +85,12 @@ func runInteractiveInit(ctx context.Context) error {
 		if err := resetLocalStoreIfNeeded(providerCfg); err != nil {
 			return err
 		}
+		w, err := openEnvWriter(ctx, projectCfg, globalCfg, envName)
+		if err != nil {
+			return err
+		}
 		for k, v := range entries {
-			if err := WriteSecret(ctx, projectCfg, globalCfg, envName, k, v); err != nil {
+			if err := w.Set(ctx, k, v); err != nil {
 				return err
 			}
 		}
@@ -209,24 +213,36 @@ func runInteractiveGlobalSetup(ctx context.Context) error {
 		}
 	}
 
-	globalCfg.Providers[providerName] = provider.ProviderConfig{
-		Type:       providerType,
+	globalCfg.Providers[providerName] = localFileProviderConfig(storePath, keyPath)
+	if err := writeGlobalConfig(globalPath, globalCfg); err != nil {
+		return err
+	}
+
+	fmt.Printf("Updated %s with provider %s (%s)\n", globalPath, providerName, providerType)
+	return nil
+}
+
+// localFileProviderConfig is the provider block init --global writes for a
+// local-file store encrypted with a key file.
+func localFileProviderConfig(storePath, keyPath string) provider.ProviderConfig {
+	return provider.ProviderConfig{
+		Type:       "local-file",
 		Path:       storePath,
 		Encryption: &provider.EncryptionConfig{KeyFile: keyPath},
 	}
+}
 
-	raw, err := yaml.Marshal(globalCfg)
+func writeGlobalConfig(path string, cfg GlobalConfig) error {
+	raw, err := yaml.Marshal(cfg)
 	if err != nil {
 		return err
 	}
-	if err := os.MkdirAll(filepath.Dir(globalPath), 0o700); err != nil {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
 		return fmt.Errorf("create global config dir: %w", err)
 	}
-	if err := os.WriteFile(globalPath, raw, 0o600); err != nil {
-		return fmt.Errorf("write %s: %w", globalPath, err)
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
 	}
-
-	fmt.Printf("Updated %s with provider %s (%s)\n", globalPath, providerName, providerType)
 	return nil
 }
 
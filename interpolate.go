@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// InterpolateConfig controls ${KEY} expansion in an env's values. In YAML it
+// is either a boolean or a mapping, which implies enabled:
+//
+//	interpolate:
+//	  host_env: true  # fall back to the process environment
+//	  strict: true    # fail on references that resolve to nothing
+type InterpolateConfig struct {
+	Enabled bool `yaml:"-"`
+	HostEnv bool `yaml:"host_env,omitempty"`
+	Strict  bool `yaml:"strict,omitempty"`
+}
+
+func (c *InterpolateConfig) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&c.Enabled)
+	}
+	type plain InterpolateConfig
+	if err := node.Decode((*plain)(c)); err != nil {
+		return err
+	}
+	c.Enabled = true
+	return nil
+}
+
+func (c InterpolateConfig) MarshalYAML() (any, error) {
+	if !c.HostEnv && !c.Strict {
+		return c.Enabled, nil
+	}
+	type plain InterpolateConfig
+	return plain(c), nil
+}
+
+// IsZero keeps a disabled config out of marshalled project files.
+func (c InterpolateConfig) IsZero() bool {
+	return !c.Enabled && !c.HostEnv && !c.Strict
+}
+
+// Interpolate expands ${KEY} references in values to other values and, with
+// HostEnv, to variables from lookupEnv. $$ is a literal $, so $${KEY} stays
+// unexpanded. Undefined references expand to "" unless Strict is set.
+func Interpolate(values map[string]string, cfg InterpolateConfig, lookupEnv func(string) (string, bool)) (map[string]string, error) {
+	if !cfg.Enabled {
+		return values, nil
+	}
+	in := &interpolator{
+		values:    values,
+		cfg:       cfg,
+		lookupEnv: lookupEnv,
+		resolved:  make(map[string]string, len(values)),
+		visiting:  map[string]bool{},
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if _, err := in.resolve(k, nil); err != nil {
+			return nil, err
+		}
+	}
+	return in.resolved, nil
+}
+
+type interpolator struct {
+	values    map[string]string
+	cfg       InterpolateConfig
+	lookupEnv func(string) (string, bool)
+	resolved  map[string]string
+	visiting  map[string]bool
+}
+
+func (in *interpolator) resolve(key string, path []string) (string, error) {
+	if v, ok := in.resolved[key]; ok {
+		return v, nil
+	}
+	path = append(path, key)
+	if in.visiting[key] {
+		return "", fmt.Errorf("%s: reference cycle %s", path[0], strings.Join(path, " → "))
+	}
+	in.visiting[key] = true
+	defer delete(in.visiting, key)
+
+	raw := in.values[key]
+	var b strings.Builder
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '$' || i+1 == len(raw) {
+			b.WriteByte(raw[i])
+			continue
+		}
+		switch raw[i+1] {
+		case '$':
+			b.WriteByte('$')
+			i++
+			continue
+		case '{':
+			end := strings.IndexByte(raw[i+2:], '}')
+			if end < 0 {
+				b.WriteByte('$')
+				continue
+			}
+			ref := raw[i+2 : i+2+end]
+			value, err := in.lookup(key, ref, path)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(value)
+			i += 2 + end
+		default:
+			b.WriteByte('$')
+		}
+	}
+	in.resolved[key] = b.String()
+	return in.resolved[key], nil
+}
+
+func (in *interpolator) lookup(key, ref string, path []string) (string, error) {
+	if _, ok := in.values[ref]; ok {
+		return in.resolve(ref, path)
+	}
+	if in.cfg.HostEnv && in.lookupEnv != nil {
+		if v, ok := in.lookupEnv(ref); ok {
+			return v, nil
+		}
+	}
+	if in.cfg.Strict {
+		return "", fmt.Errorf("%s: undefined reference ${%s}", key, ref)
+	}
+	return "", nil
+}
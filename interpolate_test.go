@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestInterpolate(t *testing.T) {
+	values := map[string]string{
+		"DB_USER":      "app",
+		"DB_PASSWORD":  "p@ss",
+		"DB_HOST":      "${DB_HOST_NAME}:5432",
+		"DB_HOST_NAME": "db.internal",
+		"DATABASE_URL": "postgres://${DB_USER}:${DB_PASSWORD}@${DB_HOST}/app",
+		"ESCAPED":      "cost $$5 and $${DB_USER}",
+		"BARE":         "$DB_USER ${unterminated",
+		"HOME_DIR":     "${HOME}/data",
+		"MISSING":      "[${NOPE}]",
+	}
+	host := func(k string) (string, bool) {
+		if k == "HOME" {
+			return "/home/app", true
+		}
+		return "", false
+	}
+	got, err := Interpolate(values, InterpolateConfig{Enabled: true, HostEnv: true}, host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"DATABASE_URL": "postgres://app:p@ss@db.internal:5432/app",
+		"ESCAPED":      "cost $5 and ${DB_USER}",
+		"BARE":         "$DB_USER ${unterminated",
+		"HOME_DIR":     "/home/app/data",
+		"MISSING":      "[]",
+	}
+	for k, w := range want {
+		if got[k] != w {
+			t.Errorf("%s = %q, want %q", k, got[k], w)
+		}
+	}
+
+	got, _ = Interpolate(values, InterpolateConfig{Enabled: true}, host)
+	if got["HOME_DIR"] != "/data" {
+		t.Errorf("HOME_DIR without host_env = %q, want /data", got["HOME_DIR"])
+	}
+
+	got, _ = Interpolate(values, InterpolateConfig{}, host)
+	if got["DATABASE_URL"] != values["DATABASE_URL"] {
+		t.Error("disabled interpolation changed values")
+	}
+}
+
+func TestInterpolateErrors(t *testing.T) {
+	_, err := Interpolate(map[string]string{"A": "${B}", "B": "x${C}", "C": "${A}"}, InterpolateConfig{Enabled: true}, nil)
+	if err == nil || !strings.Contains(err.Error(), "reference cycle A → B → C → A") {
+		t.Errorf("cycle error = %v", err)
+	}
+	_, err = Interpolate(map[string]string{"A": "${SELF}", "SELF": "${SELF}"}, InterpolateConfig{Enabled: true}, nil)
+	if err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("self-reference error = %v", err)
+	}
+	_, err = Interpolate(map[string]string{"A": "${NOPE}"}, InterpolateConfig{Enabled: true, Strict: true}, nil)
+	if err == nil || !strings.Contains(err.Error(), "A: undefined reference ${NOPE}") {
+		t.Errorf("strict error = %v", err)
+	}
+}
+
+func TestInterpolateConfigYAML(t *testing.T) {
+	var env EnvConfig
+	if err := yaml.Unmarshal([]byte("interpolate: true\n"), &env); err != nil {
+		t.Fatal(err)
+	}
+	if !env.Interpolate.Enabled || env.Interpolate.Strict {
+		t.Errorf("bool form = %+v", env.Interpolate)
+	}
+	env = EnvConfig{}
+	if err := yaml.Unmarshal([]byte("interpolate:\n  strict: true\n"), &env); err != nil {
+		t.Fatal(err)
+	}
+	if !env.Interpolate.Enabled || !env.Interpolate.Strict {
+		t.Errorf("mapping form = %+v", env.Interpolate)
+	}
+	out, err := yaml.Marshal(EnvConfig{Provider: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "interpolate") {
+		t.Errorf("disabled interpolate written:\n%s", out)
+	}
+}
+
+func TestCollectEnvInterpolates(t *testing.T) {
+	projectCfg, globalCfg := localTestConfig(t)
+	ctx := context.Background()
+	env := projectCfg.Envs["dev"]
+	env.Interpolate = InterpolateConfig{Enabled: true, Strict: true}
+	projectCfg.Envs["dev"] = env
+	for k, v := range map[string]string{"USER": "app", "URL": "postgres://${USER}@db"} {
+		if err := WriteSecret(ctx, projectCfg, globalCfg, "dev", k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := CollectEnv(ctx, projectCfg, globalCfg, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["URL"] != "postgres://app@db" {
+		t.Errorf("URL = %q", got["URL"])
+	}
+	// sync writes the same expanded values, keeping each record's metadata.
+	records, err := CollectInterpolatedEnv(ctx, projectCfg, globalCfg, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := records["URL"]; rec.Value != "postgres://app@db" || rec.CreatedAt.IsZero() {
+		t.Errorf("URL record = %+v, want expanded value with metadata", rec)
+	}
+	if err := WriteSecret(ctx, projectCfg, globalCfg, "dev", "BROKEN", "${MISSING}"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CollectEnv(ctx, projectCfg, globalCfg, "dev"); err == nil {
+		t.Error("CollectEnv succeeded with undefined reference in strict mode")
+	}
+}
+
+func TestCheckEnvKeysInterpolates(t *testing.T) {
+	projectCfg, globalCfg := localTestConfig(t)
+	ctx := context.Background()
+	env := projectCfg.Envs["dev"]
+	env.Interpolate = InterpolateConfig{Enabled: true, Strict: true}
+	env.Required = []KeySpec{{Name: "API_URL", Type: KeyTypeURL}}
+	projectCfg.Envs["dev"] = env
+	for k, v := range map[string]string{"BASE": "https://api.internal", "API_URL": "${BASE}/v1"} {
+		if err := WriteSecret(ctx, projectCfg, globalCfg, "dev", k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !checkEnvKeys(ctx, projectCfg, globalCfg) {
+		t.Error("checkEnvKeys rejected a URL built by interpolation")
+	}
+	if err := WriteSecret(ctx, projectCfg, globalCfg, "dev", "BROKEN", "${MISSING}"); err != nil {
+		t.Fatal(err)
+	}
+	if checkEnvKeys(ctx, projectCfg, globalCfg) {
+		t.Error("checkEnvKeys passed with an undefined reference in strict mode")
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Key type hints accepted in required/optional key specs.
+const (
+	KeyTypeString = "string"
+	KeyTypeURL    = "url"
+	KeyTypeInt    = "int"
+	KeyTypeBool   = "bool"
+)
+
+// KeySpec declares one variable an env expects. In YAML it is either a bare
+// key name or a mapping with name plus optional type, pattern and delivery.
+type KeySpec struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type,omitempty"`
+	// Pattern is a regular expression the whole value must match.
+	Pattern string `yaml:"pattern,omitempty"`
+	// As is "file" to hand the value to `run` as a file instead of a variable.
+	As string `yaml:"as,omitempty"`
+	// FileEnv names the variable holding the file path; default NAME_FILE.
+	FileEnv string `yaml:"file_env,omitempty"`
+}
+
+// KeySpec.As values.
+const (
+	DeliverEnv  = "env"
+	DeliverFile = "file"
+)
+
+func (k *KeySpec) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		k.Name = node.Value
+		return nil
+	}
+	type plain KeySpec
+	return node.Decode((*plain)(k))
+}
+
+func (k KeySpec) MarshalYAML() (any, error) {
+	if k.Type == "" && k.Pattern == "" && k.As == "" && k.FileEnv == "" {
+		return k.Name, nil
+	}
+	type plain KeySpec
+	return plain(k), nil
+}
+
+func (k KeySpec) validate() error {
+	if k.Name == "" {
+		return errors.New("key spec missing name")
+	}
+	switch k.Type {
+	case "", KeyTypeString, KeyTypeURL, KeyTypeInt, KeyTypeBool:
+	default:
+		return fmt.Errorf("key %s: unknown type %q (use string, url, int or bool)", k.Name, k.Type)
+	}
+	if k.Pattern != "" {
+		if _, err := regexp.Compile(k.Pattern); err != nil {
+			return fmt.Errorf("key %s: invalid pattern: %w", k.Name, err)
+		}
+	}
+	switch k.As {
+	case "", DeliverEnv:
+		if k.FileEnv != "" {
+			return fmt.Errorf("key %s: file_env requires as: file", k.Name)
+		}
+	case DeliverFile:
+	default:
+		return fmt.Errorf("key %s: unknown as %q (use env or file)", k.Name, k.As)
+	}
+	return nil
+}
+
+// SecretFiles lists the keys `run` delivers as files for envName, including
+// those declared by the envs it extends. The nearest declaration of a key wins.
+func (c ProjectConfig) SecretFiles(envName string) ([]SecretFile, error) {
+	chain, err := c.ExtendsChain(envName)
+	if err != nil {
+		return nil, err
+	}
+	var files []SecretFile
+	declared := map[string]bool{}
+	for _, name := range chain {
+		env := c.Envs[name]
+		for _, spec := range append(append([]KeySpec(nil), env.Required...), env.Optional...) {
+			if declared[spec.Name] {
+				continue
+			}
+			declared[spec.Name] = true
+			if f, ok := spec.secretFile(); ok {
+				files = append(files, f)
+			}
+		}
+	}
+	return files, nil
+}
+
+func (k KeySpec) secretFile() (SecretFile, bool) {
+	if k.As != DeliverFile {
+		return SecretFile{}, false
+	}
+	env := k.FileEnv
+	if env == "" {
+		env = k.Name + "_FILE"
+	}
+	return SecretFile{Key: k.Name, Env: env}, true
+}
+
+// Check reports why value does not satisfy the spec, or nil if it does.
+func (k KeySpec) Check(value string) error {
+	switch k.Type {
+	case KeyTypeURL:
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme == "" || u.Host == "" && u.Opaque == "" {
+			return errors.New("not a valid URL")
+		}
+	case KeyTypeInt:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return errors.New("not an integer")
+		}
+	case KeyTypeBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return errors.New("not a boolean")
+		}
+	}
+	if k.Pattern != "" {
+		re, err := regexp.Compile("^(?:" + k.Pattern + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+		if !re.MatchString(value) {
+			return fmt.Errorf("does not match pattern %q", k.Pattern)
+		}
+	}
+	return nil
+}
+
+// HasKeySchema reports whether the env declares any required or optional keys.
+func (e EnvConfig) HasKeySchema() bool {
+	return len(e.Required) > 0 || len(e.Optional) > 0
+}
+
+func (e EnvConfig) validateKeySchema() error {
+	seen := map[string]bool{}
+	for _, spec := range append(append([]KeySpec(nil), e.Required...), e.Optional...) {
+		if err := spec.validate(); err != nil {
+			return err
+		}
+		if seen[spec.Name] {
+			return fmt.Errorf("key %s declared more than once", spec.Name)
+		}
+		seen[spec.Name] = true
+	}
+	return nil
+}
+
+// KeyReport is the result of checking secrets against an env's key schema.
+type KeyReport struct {
+	Missing []string
+	// Invalid maps key names to why their value was rejected.
+	Invalid map[string]string
+	// Unexpected lists keys not declared in the schema; it is only filled in
+	// when the env declares a schema at all.
+	Unexpected []string
+}
+
+// OK reports whether every required key is present and every declared key is valid.
+func (r KeyReport) OK() bool {
+	return len(r.Missing) == 0 && len(r.Invalid) == 0
+}
+
+// CheckKeys compares secrets against the env's required and optional keys.
+func (e EnvConfig) CheckKeys(secrets map[string]string) KeyReport {
+	report := KeyReport{Invalid: map[string]string{}}
+	if !e.HasKeySchema() {
+		return report
+	}
+	declared := map[string]bool{}
+	for _, spec := range e.Required {
+		declared[spec.Name] = true
+		value, ok := secrets[spec.Name]
+		if !ok {
+			report.Missing = append(report.Missing, spec.Name)
+			continue
+		}
+		if err := spec.Check(value); err != nil {
+			report.Invalid[spec.Name] = err.Error()
+		}
+	}
+	for _, spec := range e.Optional {
+		declared[spec.Name] = true
+		if value, ok := secrets[spec.Name]; ok {
+			if err := spec.Check(value); err != nil {
+				report.Invalid[spec.Name] = err.Error()
+			}
+		}
+	}
+	for k := range secrets {
+		if !declared[k] {
+			report.Unexpected = append(report.Unexpected, k)
+		}
+	}
+	sort.Strings(report.Missing)
+	sort.Strings(report.Unexpected)
+	return report
+}
+
+// KeySchemaError is returned when an env's secrets do not satisfy its key schema.
+type KeySchemaError struct {
+	Env    string
+	Report KeyReport
+}
+
+func (e *KeySchemaError) Error() string {
+	var parts []string
+	if len(e.Report.Missing) > 0 {
+		parts = append(parts, "missing required keys: "+strings.Join(e.Report.Missing, ", "))
+	}
+	if len(e.Report.Invalid) > 0 {
+		keys := make([]string, 0, len(e.Report.Invalid))
+		for k := range e.Report.Invalid {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		invalid := make([]string, len(keys))
+		for i, k := range keys {
+			invalid[i] = fmt.Sprintf("%s (%s)", k, e.Report.Invalid[k])
+		}
+		parts = append(parts, "invalid keys: "+strings.Join(invalid, ", "))
+	}
+	return fmt.Sprintf("env %q: %s", e.Env, strings.Join(parts, "; "))
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestKeySpecYAML(t *testing.T) {
+	src := `
+provider: local
+required:
+  - DATABASE_URL
+  - name: PORT
+    type: int
+optional:
+  - name: REGION
+    pattern: "[a-z]+-[a-z]+-[0-9]"
+`
+	var env EnvConfig
+	if err := yaml.Unmarshal([]byte(src), &env); err != nil {
+		t.Fatal(err)
+	}
+	want := []KeySpec{{Name: "DATABASE_URL"}, {Name: "PORT", Type: KeyTypeInt}}
+	if !reflect.DeepEqual(env.Required, want) {
+		t.Errorf("Required = %+v, want %+v", env.Required, want)
+	}
+	if len(env.Optional) != 1 || env.Optional[0].Pattern == "" {
+		t.Errorf("Optional = %+v, want REGION with pattern", env.Optional)
+	}
+
+	out, err := yaml.Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "- DATABASE_URL\n") {
+		t.Errorf("bare key spec not written as scalar:\n%s", out)
+	}
+}
+
+func TestKeySpecCheck(t *testing.T) {
+	tests := []struct {
+		spec  KeySpec
+		value string
+		ok    bool
+	}{
+		{KeySpec{Name: "A"}, "", true},
+		{KeySpec{Name: "A", Type: KeyTypeURL}, "postgres://db:5432/app", true},
+		{KeySpec{Name: "A", Type: KeyTypeURL}, "localhost", false},
+		{KeySpec{Name: "A", Type: KeyTypeInt}, "8080", true},
+		{KeySpec{Name: "A", Type: KeyTypeInt}, "80a", false},
+		{KeySpec{Name: "A", Type: KeyTypeBool}, "true", true},
+		{KeySpec{Name: "A", Type: KeyTypeBool}, "yes", false},
+		{KeySpec{Name: "A", Pattern: "sk_[a-z]+"}, "sk_live", true},
+		{KeySpec{Name: "A", Pattern: "sk_[a-z]+"}, "xsk_live", false},
+	}
+	for _, tt := range tests {
+		err := tt.spec.Check(tt.value)
+		if (err == nil) != tt.ok {
+			t.Errorf("%+v.Check(%q) = %v, want ok=%v", tt.spec, tt.value, err, tt.ok)
+		}
+	}
+}
+
+func TestCheckKeys(t *testing.T) {
+	env := EnvConfig{
+		Required: []KeySpec{{Name: "DATABASE_URL", Type: KeyTypeURL}, {Name: "API_KEY"}},
+		Optional: []KeySpec{{Name: "PORT", Type: KeyTypeInt}},
+	}
+	report := env.CheckKeys(map[string]string{
+		"DATABASE_URL": "not a url",
+		"PORT":         "http",
+		"EXTRA":        "x",
+	})
+	if report.OK() {
+		t.Fatal("report OK, want failures")
+	}
+	if !reflect.DeepEqual(report.Missing, []string{"API_KEY"}) {
+		t.Errorf("Missing = %v", report.Missing)
+	}
+	if len(report.Invalid) != 2 || report.Invalid["DATABASE_URL"] == "" || report.Invalid["PORT"] == "" {
+		t.Errorf("Invalid = %v", report.Invalid)
+	}
+	if !reflect.DeepEqual(report.Unexpected, []string{"EXTRA"}) {
+		t.Errorf("Unexpected = %v", report.Unexpected)
+	}
+
+	if r := (EnvConfig{}).CheckKeys(map[string]string{"ANY": "x"}); !r.OK() || len(r.Unexpected) != 0 {
+		t.Errorf("env without schema reported %+v", r)
+	}
+}
+
+func TestCollectEnvEnforcesRequiredKeys(t *testing.T) {
+	projectCfg, globalCfg := localTestConfig(t)
+	if err := WriteSecret(context.Background(), projectCfg, globalCfg, "dev", "PORT", "8080"); err != nil {
+		t.Fatal(err)
+	}
+	env := projectCfg.Envs["dev"]
+	env.Required = []KeySpec{{Name: "PORT", Type: KeyTypeInt}, {Name: "DATABASE_URL"}}
+	projectCfg.Envs["dev"] = env
+
+	_, err := CollectEnv(context.Background(), projectCfg, globalCfg, "dev")
+	var schemaErr *KeySchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Fatalf("CollectEnv error = %v, want *KeySchemaError", err)
+	}
+	if !reflect.DeepEqual(schemaErr.Report.Missing, []string{"DATABASE_URL"}) {
+		t.Errorf("Missing = %v", schemaErr.Report.Missing)
+	}
+
+	if err := WriteSecret(context.Background(), projectCfg, globalCfg, "dev", "DATABASE_URL", "postgres://db/app"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := CollectEnv(context.Background(), projectCfg, globalCfg, "dev")
+	if err != nil {
+		t.Fatalf("CollectEnv: %v", err)
+	}
+	if got["PORT"] != "8080" {
+		t.Errorf("PORT = %q", got["PORT"])
+	}
+}
+
+func TestProjectConfigValidateKeySchema(t *testing.T) {
+	cfg := ProjectConfig{
+		Project:    "x",
+		DefaultEnv: "dev",
+		Envs: map[string]EnvConfig{"dev": {
+			Provider: "y",
+			Required: []KeySpec{{Name: "A", Pattern: "("}},
+		}},
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate accepted invalid pattern")
+	}
+	cfg.Envs["dev"] = EnvConfig{Provider: "y", Required: []KeySpec{{Name: "A", Type: "float"}}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate accepted unknown type")
+	}
+	cfg.Envs["dev"] = EnvConfig{Provider: "y", Required: []KeySpec{{Name: "A"}}, Optional: []KeySpec{{Name: "A"}}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate accepted duplicate key")
+	}
+}
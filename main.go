@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -21,6 +20,10 @@ var projectConfigPath string
 func main() {
 	root := newRootCmd()
 	if err := root.Execute(); err != nil {
+		var exitErr *ExitError
+		if errors.As(err, &exitErr) {
+			exitErr.Exit()
+		}
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
@@ -32,7 +35,7 @@ func newRootCmd() *cobra.Command {
 		Short: "envMap replaces .env files with secure secret injection",
 		Long:  "envMap fetches secrets from configured backends and injects them into processes without writing .env files.",
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-			cmd.SetContext(context.Background())
+			cmd.SetContext(withRefCache(context.Background()))
 			return nil
 		},
 		SilenceUsage:  true,
@@ -48,9 +51,16 @@ func newRootCmd() *cobra.Command {
 		newSetCmd(),
 		newGetCmd(),
 		newSyncCmd(),
+		newRenderCmd(),
 		newImportCmd(),
+		newHistoryCmd(),
+		newRollbackCmd(),
 		newKeygenCmd(),
+		newRecipientsCmd(),
+		newProvidersCmd(),
 		newValidateCmd(),
+		newHookCmd(),
+		newHookEnvCmd(),
 	)
 	return cmd
 }
@@ -73,6 +83,10 @@ func newInitCmd() *cobra.Command {
 
 func newRunCmd() *cobra.Command {
 	var envName string
+	var restart string
+	var maxRestarts int
+	var watch time.Duration
+	var reloadSignal string
 	c := &cobra.Command{
 		Use:   "run [--env ENV] -- COMMAND [ARGS...]",
 		Short: "Run a command with secrets injected into the environment",
@@ -81,9 +95,26 @@ as environment variables. This allows running applications without .env files.
 
 The command and its arguments must come after a -- separator.
 
+SIGINT, SIGTERM, SIGHUP, SIGQUIT, SIGUSR1 and SIGUSR2 received by envmap are
+forwarded to the command's process group, and envmap exits with the command's
+exit code (or is killed by the same signal). With --restart on-failure the
+command is restarted with exponential backoff whenever it exits non-zero,
+unless it was stopped by a signal such as Ctrl-C or SIGTERM or, on a terminal,
+exits with the matching 128+N code (e.g. 130) after handling one.
+
+With --watch the secrets are re-fetched periodically (every 30s, or
+--watch=INTERVAL). When any change, the names of the changed keys are logged
+and the command is restarted with the new values. With --reload-signal, when
+only file-delivered secrets (as: file) changed they are rewritten in place and
+the command is sent the signal instead; a change to any key passed as an
+environment variable still restarts it, since a running process's environment
+cannot be updated.
+
 Examples:
   envmap run -- node server.js
   envmap run --env prod -- ./my-app
+  envmap run --restart on-failure --max-restarts 5 -- ./worker
+  envmap run --watch=1m --reload-signal HUP -- nginx -g 'daemon off;'
   envmap run --env dev -- npm start
   envmap run -- docker compose up`,
 		Args:               cobra.MinimumNArgs(1),
@@ -92,6 +123,20 @@ Examples:
 			if len(args) == 0 {
 				return errors.New("no command specified; usage: envmap run -- COMMAND [ARGS...]")
 			}
+			if restart != RestartNever && restart != RestartOnFailure {
+				return fmt.Errorf("invalid --restart %q (use %s or %s)", restart, RestartNever, RestartOnFailure)
+			}
+			var sig os.Signal
+			if reloadSignal != "" {
+				if watch <= 0 {
+					return errors.New("--reload-signal requires --watch")
+				}
+				parsed, err := parseSignal(reloadSignal)
+				if err != nil {
+					return err
+				}
+				sig = parsed
+			}
 			projectCfg, _, err := loadProjectConfig()
 			if err != nil {
 				return err
@@ -104,34 +149,66 @@ Examples:
 			if err != nil {
 				return err
 			}
+			files, err := projectCfg.SecretFiles(envToUse)
+			if err != nil {
+				return err
+			}
 			secretEnv, err := CollectEnv(cmd.Context(), projectCfg, globalCfg, envToUse)
 			if err != nil {
 				return err
 			}
 			fmt.Fprintf(os.Stderr, "envmap: injecting %d secrets from env %q\n", len(secretEnv), envToUse)
-			return SpawnWithEnv(cmd.Context(), args[0], args[1:], secretEnv)
+			return SpawnWithEnv(cmd.Context(), args[0], args[1:], secretEnv, RunOptions{
+				Files:       files,
+				Restart:     restart,
+				MaxRestarts: maxRestarts,
+				Watch:       watch,
+				Reload: func(ctx context.Context) (map[string]string, error) {
+					// A fresh reference cache so rotated referenced secrets are seen too.
+					return CollectEnv(withRefCache(ctx), projectCfg, globalCfg, envToUse)
+				},
+				ReloadSignal: sig,
+			})
 		},
 	}
 	c.Flags().StringVar(&envName, "env", "", "environment name to use (defaults to project default_env)")
+	c.Flags().StringVar(&restart, "restart", RestartNever, "restart policy: no or on-failure")
+	c.Flags().IntVar(&maxRestarts, "max-restarts", 0, "give up after this many restarts (0 = unlimited)")
+	c.Flags().DurationVar(&watch, "watch", 0, "re-fetch secrets at this interval and reload the command on change (--watch alone: 30s)")
+	c.Flags().Lookup("watch").NoOptDefVal = "30s"
+	c.Flags().StringVar(&reloadSignal, "reload-signal", "", "signal to send on change instead of restarting (e.g. HUP)")
 	return c
 }
 
 func newExportCmd() *cobra.Command {
 	var envName string
 	var format string
+	var opts ExportOptions
+	var formats strings.Builder
+	for _, f := range ExportFormats() {
+		fmt.Fprintf(&formats, "  %-11s %s\n", f.Name, f.Description)
+	}
 	c := &cobra.Command{
 		Use:   "export",
 		Short: "Export secrets to stdout for shell eval or tooling",
 		Long: `Export secrets in machine-readable format to stdout.
 
 Formats:
-  plain   KEY=VAL lines, suitable for shell eval or direnv
-  json    JSON object, suitable for tooling
+` + formats.String() + `
+Keys that the target cannot represent are skipped with a warning.
 
 Examples:
-  eval $(envmap export --env dev)
-  envmap export --env dev --format json | jq .`,
+  eval "$(envmap export --env dev)"
+  envmap export --env dev --format fish | source
+  envmap export --env dev --format json | jq .
+  envmap export --env prod --format docker > prod.env && docker run --env-file prod.env app
+  envmap export --env prod --format kubernetes --name app-secrets --namespace web | kubectl apply -f -
+  envmap export --env ci --format github >> "$GITHUB_ENV"`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			exportFormat, err := lookupExportFormat(format)
+			if err != nil {
+				return err
+			}
 			projectCfg, _, err := loadProjectConfig()
 			if err != nil {
 				return err
@@ -148,29 +225,16 @@ Examples:
 			if err != nil {
 				return err
 			}
-
-			switch format {
-			case "plain", "":
-				keys := make([]string, 0, len(secretEnv))
-				for k := range secretEnv {
-					keys = append(keys, k)
-				}
-				sort.Strings(keys)
-				for _, k := range keys {
-					fmt.Printf("%s=%s\n", k, secretEnv[k])
-				}
-			case "json":
-				enc := json.NewEncoder(os.Stdout)
-				enc.SetIndent("", "  ")
-				return enc.Encode(secretEnv)
-			default:
-				return fmt.Errorf("unknown format %q (use plain or json)", format)
+			if opts.Name == "" {
+				opts.Name = envToUse
 			}
-			return nil
+			return exportFormat.Write(os.Stdout, secretEnv, opts)
 		},
 	}
 	c.Flags().StringVar(&envName, "env", "", "environment name to use (defaults to project default_env)")
-	c.Flags().StringVar(&format, "format", "plain", "output format: plain or json")
+	c.Flags().StringVar(&format, "format", "plain", "output format (see above)")
+	c.Flags().StringVar(&opts.Name, "name", "", "object name for the kubernetes format (defaults to the env name)")
+	c.Flags().StringVar(&opts.Namespace, "namespace", "", "namespace for the kubernetes format")
 	return c
 }
 
@@ -188,26 +252,11 @@ func newSetCmd() *cobra.Command {
 				return errors.New("provide --env to select which environment to target")
 			}
 			key := args[0]
-			var value string
-			if deleteKey {
-				value = ""
-			} else {
+			if !deleteKey {
 				if fromFile != "" && promptSecret {
 					return errors.New("use only one of --file or --prompt")
 				}
-				if fromFile != "" {
-					valueBytes, err := os.ReadFile(fromFile)
-					if err != nil {
-						return fmt.Errorf("read secret file: %w", err)
-					}
-					value = strings.TrimSpace(string(valueBytes))
-				} else if promptSecret {
-					v, err := readSecretFromPrompt("Secret value: ")
-					if err != nil {
-						return err
-					}
-					value = v
-				} else {
+				if fromFile == "" && !promptSecret {
 					return errors.New("provide --file or --prompt to supply the secret without shell history leakage")
 				}
 			}
@@ -219,8 +268,33 @@ func newSetCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			required := provider.CapWrite
 			if deleteKey {
-				return DeleteSecret(cmd.Context(), projectCfg, globalCfg, envName, key)
+				required = provider.CapDelete
+			}
+			if err := RequireCapabilities(projectCfg, globalCfg, envName, required); err != nil {
+				return err
+			}
+			if deleteKey {
+				if err := DeleteSecret(cmd.Context(), projectCfg, globalCfg, envName, key); err != nil {
+					return err
+				}
+				fmt.Printf("Deleted %s from env %s\n", key, envName)
+				return nil
+			}
+			var value string
+			if fromFile != "" {
+				valueBytes, err := os.ReadFile(fromFile)
+				if err != nil {
+					return fmt.Errorf("read secret file: %w", err)
+				}
+				value = strings.TrimSpace(string(valueBytes))
+			} else if promptSecret {
+				v, err := readSecretFromPrompt("Secret value: ")
+				if err != nil {
+					return err
+				}
+				value = v
 			}
 			return WriteSecret(cmd.Context(), projectCfg, globalCfg, envName, key, value)
 		},
@@ -291,6 +365,85 @@ func newGetCmd() *cobra.Command {
 	return c
 }
 
+func newHistoryCmd() *cobra.Command {
+	var envName string
+	var raw bool
+	c := &cobra.Command{
+		Use:   "history --env ENV KEY",
+		Short: "Show prior versions of a secret",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if envName == "" {
+				return errors.New("provide --env to select which environment to target")
+			}
+			projectCfg, _, err := loadProjectConfig()
+			if err != nil {
+				return err
+			}
+			globalCfg, err := LoadGlobalConfig("")
+			if err != nil {
+				return err
+			}
+			versions, err := SecretHistory(cmd.Context(), projectCfg, globalCfg, envName, args[0])
+			if err != nil {
+				return err
+			}
+			for _, v := range versions {
+				val := v.Value
+				if !raw {
+					val = MaskValue(val)
+				}
+				fmt.Printf("v%d  %s", v.Version, val)
+				if !v.CreatedAt.IsZero() {
+					fmt.Printf("  # %s", v.CreatedAt.UTC().Format(time.RFC3339))
+				}
+				if v.Current {
+					fmt.Print("  (current)")
+				}
+				fmt.Println()
+			}
+			return nil
+		},
+	}
+	c.Flags().StringVar(&envName, "env", "", "environment name to target")
+	c.Flags().BoolVar(&raw, "raw", false, "print raw secret values (use with care)")
+	return c
+}
+
+func newRollbackCmd() *cobra.Command {
+	var envName string
+	var version int
+	c := &cobra.Command{
+		Use:   "rollback --env ENV KEY --to N",
+		Short: "Restore a prior version of a secret",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if envName == "" {
+				return errors.New("provide --env to select which environment to target")
+			}
+			if version <= 0 {
+				return errors.New("provide --to with the version to restore (see envmap history)")
+			}
+			projectCfg, _, err := loadProjectConfig()
+			if err != nil {
+				return err
+			}
+			globalCfg, err := LoadGlobalConfig("")
+			if err != nil {
+				return err
+			}
+			if err := RollbackSecret(cmd.Context(), projectCfg, globalCfg, envName, args[0], version); err != nil {
+				return err
+			}
+			fmt.Printf("Restored %s to version %d in env %s\n", args[0], version, envName)
+			return nil
+		},
+	}
+	c.Flags().StringVar(&envName, "env", "", "environment name to target")
+	c.Flags().IntVar(&version, "to", 0, "version number to restore")
+	return c
+}
+
 func newImportCmd() *cobra.Command {
 	var envName string
 	var deleteAfter bool
@@ -303,11 +456,12 @@ func newImportCmd() *cobra.Command {
 				return errors.New("provide --env to select which environment to import into")
 			}
 			path := args[0]
-			entries, err := parseDotEnv(path)
+			entries, err := readDotEnv(path)
 			if err != nil {
 				return err
 			}
-			if len(entries) == 0 {
+			values, keys := dotEnvValues(entries), dotEnvKeys(entries)
+			if len(keys) == 0 {
 				return fmt.Errorf("no entries found in %s", path)
 			}
 			projectCfg, _, err := loadProjectConfig()
@@ -318,12 +472,21 @@ func newImportCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			fmt.Printf("Importing %d keys into env %s from %s\n", len(entries), envName, path)
-			for k := range entries {
+			// One writer for the whole import: the provider is instantiated,
+			// unlocked and listed once rather than once per key.
+			w, err := openEnvWriter(cmd.Context(), projectCfg, globalCfg, envName)
+			if err != nil {
+				return err
+			}
+			if err := provider.RequireCapabilities(w.p, w.target.GetProvider(), provider.CapWrite); err != nil {
+				return err
+			}
+			fmt.Printf("Importing %d keys into env %s from %s\n", len(keys), envName, path)
+			for _, k := range keys {
 				fmt.Printf(" - %s\n", k)
 			}
-			for k, v := range entries {
-				if err := WriteSecret(cmd.Context(), projectCfg, globalCfg, envName, k, v); err != nil {
+			for _, k := range keys {
+				if err := w.Set(cmd.Context(), k, values[k]); err != nil {
 					return err
 				}
 			}
@@ -349,9 +512,23 @@ func newSyncCmd() *cobra.Command {
 	var force bool
 	var backup bool
 	var checkOnly bool
+	var annotate bool
 	c := &cobra.Command{
 		Use:   "sync",
 		Short: "Sync provider secrets to a .env-style file",
+		Long: `Write provider secrets to a .env-style file.
+
+An existing file is updated in place: changed values are rewritten on their
+own lines, while comments, blank lines and ordering are kept. Keys new to the
+file are appended below a "# added by envmap sync" marker, and keys no longer
+in the provider are removed unless --merge is given. Nothing is written when
+the file is already up to date.
+
+Values are written as run would inject them: ${KEY} references are expanded
+for envs with interpolate set, so the file needs no further expansion.
+
+With --annotate, each provider key gets a "# envmap: created ..., from ..."
+comment that is refreshed whenever its value changes.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if envName == "" {
 				return errors.New("provide --env to select which environment to sync")
@@ -368,18 +545,28 @@ func newSyncCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			if err := RequireCapabilities(projectCfg, globalCfg, envToUse, provider.CapRead); err != nil {
+				return err
+			}
 			dest := outPath
 			if dest == "" {
 				dest = ".env"
 			}
-			records, err := CollectEnvWithMetadata(cmd.Context(), projectCfg, globalCfg, envToUse)
+			records, err := CollectInterpolatedEnv(cmd.Context(), projectCfg, globalCfg, envToUse)
 			if err != nil {
 				return err
 			}
 			if checkOnly {
 				return checkEnvDrift(dest, records)
 			}
-			return syncEnvFile(dest, records, merge, keepLocal, force, backup)
+			return syncEnvFile(dest, records, syncOptions{
+				Merge:     merge,
+				KeepLocal: keepLocal,
+				Force:     force,
+				Backup:    backup,
+				Annotate:  annotate,
+				Source:    projectCfg.Envs[envToUse].SourceLabel(),
+			})
 		},
 	}
 	c.Flags().StringVar(&envName, "env", "", "environment name to sync from")
@@ -389,15 +576,40 @@ func newSyncCmd() *cobra.Command {
 	c.Flags().BoolVar(&force, "force", false, "skip confirmation even if file is tracked or will be overwritten")
 	c.Flags().BoolVar(&backup, "backup", true, "write a .bak file before overwriting")
 	c.Flags().BoolVar(&checkOnly, "check", false, "only report drift; do not write")
+	c.Flags().BoolVar(&annotate, "annotate", false, "add provenance comments (created-at, source) above provider keys")
 	return c
 }
 
 func newKeygenCmd() *cobra.Command {
 	var output string
+	var rotate bool
+	var providerName string
+	var newKeyEnv string
 	c := &cobra.Command{
 		Use:   "keygen",
-		Short: "Generate a local-store encryption key",
+		Short: "Generate or rotate a local-store encryption key",
+		Long: `Generate a local-store encryption key, or rotate an existing store to a new key.
+
+With --rotate, the store is decrypted with the current key, re-encrypted with a
+new one and verified before the old key is discarded. A key_file is replaced in
+place (the previous key is kept as KEY_FILE.bak until verification succeeds);
+use --new-key-env to move a store to a key held in an environment variable.
+
+Examples:
+  envmap keygen
+  envmap keygen --rotate
+  envmap keygen --rotate --provider local-dev --new-key-env ENVMAP_KEY_2025`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if rotate {
+				if output != "" {
+					return errors.New("--output cannot be combined with --rotate; the configured key_file is replaced in place")
+				}
+				globalCfg, err := LoadGlobalConfig("")
+				if err != nil {
+					return err
+				}
+				return rotateLocalKey(cmd.Context(), globalCfg, providerName, newKeyEnv)
+			}
 			if output == "" {
 				home, err := os.UserHomeDir()
 				if err != nil {
@@ -406,7 +618,7 @@ func newKeygenCmd() *cobra.Command {
 				output = filepath.Join(home, ".envmap", "key")
 			}
 			if _, err := os.Stat(output); err == nil {
-				return fmt.Errorf("key file %s already exists; remove it first if you want to regenerate", output)
+				return fmt.Errorf("key file %s already exists; remove it first or use --rotate to re-encrypt the store", output)
 			}
 			if err := provider.GenerateKeyFile(output); err != nil {
 				return err
@@ -417,6 +629,67 @@ func newKeygenCmd() *cobra.Command {
 		},
 	}
 	c.Flags().StringVarP(&output, "output", "o", "", "output path (default: ~/.envmap/key)")
+	c.Flags().BoolVar(&rotate, "rotate", false, "re-encrypt an existing local store under a new key")
+	c.Flags().StringVar(&providerName, "provider", "", "with --rotate, the local-file provider to rotate (required if more than one)")
+	c.Flags().StringVar(&newKeyEnv, "new-key-env", "", "with --rotate, re-encrypt using the key in this env var instead of a new key file")
+	return c
+}
+
+func newRecipientsCmd() *cobra.Command {
+	var providerName string
+	c := &cobra.Command{
+		Use:   "recipients list|add|remove [AGE_PUBLIC_KEY...]",
+		Short: "Manage who can decrypt an age-encrypted local store",
+		Long: `Manage the age recipients of a local-file store configured with encryption.type: age.
+
+Adding a recipient re-wraps the store's data key; removing one moves the store
+to a fresh data key. Secrets are re-encrypted in place and never need re-entering.
+The recipient list in ~/.envmap/config.yaml is only used when creating a new store.
+
+Examples:
+  envmap recipients list
+  envmap recipients add age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p
+  envmap recipients remove --provider team age1...`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			globalCfg, err := LoadGlobalConfig("")
+			if err != nil {
+				return err
+			}
+			if cfg, ok := globalCfg.GetProviders()[providerName]; ok && cfg.Type == "project-file" {
+				return fmt.Errorf("provider %q is a project-file store; recipients can only be managed for local-file stores (a project file is encrypted to encryption.recipients when it is created)", providerName)
+			}
+			_, providerCfg, err := selectLocalProvider(globalCfg, providerName)
+			if err != nil {
+				return err
+			}
+			action, keys := args[0], args[1:]
+			var recipients []string
+			switch action {
+			case "list":
+				recipients, err = provider.StoreRecipients(providerCfg.Path, providerCfg.Encryption)
+			case "add", "remove":
+				if len(keys) == 0 {
+					return fmt.Errorf("provide at least one age public key to %s", action)
+				}
+				if action == "add" {
+					recipients, err = provider.AddRecipients(providerCfg.Path, providerCfg.Encryption, keys)
+				} else {
+					recipients, err = provider.RemoveRecipients(providerCfg.Path, providerCfg.Encryption, keys)
+				}
+			default:
+				return fmt.Errorf("unknown action %q (use list, add or remove)", action)
+			}
+			if err != nil {
+				return err
+			}
+			for _, r := range recipients {
+				fmt.Println(r)
+			}
+			return nil
+		},
+	}
+	c.Flags().StringVar(&providerName, "provider", "", "local-file provider to manage (required if more than one)")
 	return c
 }
 
@@ -429,18 +702,38 @@ func newValidateCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			fmt.Printf("Project: %s\n", projectCfg.Project)
+			fmt.Printf("Envs: %d (default: %s)\n", len(projectCfg.Envs), projectCfg.DefaultEnv)
+			envNames := make([]string, 0, len(projectCfg.Envs))
+			for name := range projectCfg.Envs {
+				envNames = append(envNames, name)
+			}
+			sort.Strings(envNames)
+			for _, name := range envNames {
+				if chain, err := projectCfg.ExtendsChain(name); err == nil && len(chain) > 1 {
+					fmt.Printf("  %s inherits %s\n", name, strings.Join(chain, " → "))
+				}
+			}
 			globalCfg, err := LoadGlobalConfig("")
+			var cfgErr *ConfigError
+			if errors.As(err, &cfgErr) {
+				fmt.Printf("\nInvalid provider config in %s:\n", cfgErr.Path)
+				for _, issue := range cfgErr.Issues {
+					fmt.Printf("  line %d, column %d: %s\n", issue.Line, issue.Column, issue.Error())
+				}
+				return fmt.Errorf("invalid global config")
+			}
 			if err != nil {
 				return err
 			}
-			fmt.Printf("Project: %s\n", projectCfg.Project)
-			fmt.Printf("Envs: %d (default: %s)\n", len(projectCfg.Envs), projectCfg.DefaultEnv)
 			providers := globalCfg.GetProviders()
 			missing := []string{}
 			for envName, envCfg := range projectCfg.Envs {
-				providerName := envCfg.GetProvider()
-				if _, ok := providers[providerName]; !ok {
-					missing = append(missing, fmt.Sprintf("%s → %s", envName, providerName))
+				for _, layer := range envCfg.Layers() {
+					providerName := layer.GetProvider()
+					if _, ok := providers[providerName]; !ok {
+						missing = append(missing, fmt.Sprintf("%s → %s", envName, providerName))
+					}
 				}
 			}
 			if len(missing) > 0 {
@@ -450,12 +743,66 @@ func newValidateCmd() *cobra.Command {
 				}
 				return fmt.Errorf("missing providers")
 			}
+			if !checkEnvKeys(cmd.Context(), projectCfg, globalCfg) {
+				return fmt.Errorf("secrets do not match required keys")
+			}
 			fmt.Println("Configuration looks good.")
 			return nil
 		},
 	}
 }
 
+// checkEnvKeys fetches and interpolates secrets, as run does, for every env
+// that declares required or optional keys and prints missing, invalid and
+// unexpected keys per env.
+func checkEnvKeys(ctx context.Context, projectCfg ProjectConfig, globalCfg GlobalConfig) bool {
+	envNames := make([]string, 0, len(projectCfg.Envs))
+	for name, envCfg := range projectCfg.Envs {
+		if envCfg.HasKeySchema() {
+			envNames = append(envNames, name)
+		}
+	}
+	sort.Strings(envNames)
+	ok := true
+	for _, envName := range envNames {
+		envCfg := projectCfg.Envs[envName]
+		records, err := CollectInterpolatedEnv(ctx, projectCfg, globalCfg, envName)
+		if err != nil {
+			fmt.Printf("\nEnv %s: could not check keys: %v\n", envName, err)
+			ok = false
+			continue
+		}
+		secrets := make(map[string]string, len(records))
+		for k, rec := range records {
+			secrets[k] = rec.Value
+		}
+		report := envCfg.CheckKeys(secrets)
+		if report.OK() && len(report.Unexpected) == 0 {
+			fmt.Printf("Env %s: %d required keys present\n", envName, len(envCfg.Required))
+			continue
+		}
+		fmt.Printf("\nEnv %s:\n", envName)
+		for _, k := range report.Missing {
+			fmt.Printf("  missing     %s\n", k)
+		}
+		invalid := make([]string, 0, len(report.Invalid))
+		for k := range report.Invalid {
+			invalid = append(invalid, k)
+		}
+		sort.Strings(invalid)
+		for _, k := range invalid {
+			fmt.Printf("  invalid     %s: %s\n", k, report.Invalid[k])
+		}
+		for _, k := range report.Unexpected {
+			fmt.Printf("  unexpected  %s\n", k)
+		}
+		if !report.OK() {
+			ok = false
+		}
+	}
+	return ok
+}
+
 func printEnvSecrets(ctx context.Context, projectCfg ProjectConfig, globalCfg GlobalConfig, envName string, raw bool) error {
 	records, err := CollectEnvWithMetadata(ctx, projectCfg, globalCfg, envName)
 	if err != nil {
@@ -475,8 +822,15 @@ func printEnvSecrets(ctx context.Context, projectCfg ProjectConfig, globalCfg Gl
 			val = MaskValue(val)
 		}
 		fmt.Printf("%s=%s", k, val)
+		var notes []string
 		if !rec.CreatedAt.IsZero() {
-			fmt.Printf("  # created %s", rec.CreatedAt.UTC().Format(time.RFC3339))
+			notes = append(notes, "created "+rec.CreatedAt.UTC().Format(time.RFC3339))
+		}
+		if rec.Source != "" {
+			notes = append(notes, "from "+rec.Source)
+		}
+		if len(notes) > 0 {
+			fmt.Printf("  # %s", strings.Join(notes, ", "))
 		}
 		fmt.Println()
 	}
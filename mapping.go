@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// KeyMapping renames provider keys (after prefix trimming) to env var names.
+//
+//	mapping:
+//	  normalize: true          # db/password -> DB_PASSWORD
+//	  keys:
+//	    db/password: DATABASE_PASSWORD
+//	    "stripe/*": STRIPE_$1  # * matches one path segment, ** any number
+//
+// Exact keys win over patterns, patterns are tried in file order, and keys
+// no rule matches are normalized or passed through unchanged.
+type KeyMapping struct {
+	Normalize bool        `yaml:"normalize,omitempty"`
+	Keys      MappingKeys `yaml:"keys,omitempty"`
+}
+
+// MappingRule maps one provider key or glob pattern to an env var name;
+// $1..$n in To refer to the pattern's wildcards.
+type MappingRule struct {
+	From string
+	To   string
+}
+
+// MappingKeys is an ordered list of rules written as a YAML mapping.
+type MappingKeys []MappingRule
+
+func (m *MappingKeys) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: mapping keys must be a mapping of provider key to env var name", node.Line)
+	}
+	rules := make(MappingKeys, 0, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		rules = append(rules, MappingRule{From: node.Content[i].Value, To: node.Content[i+1].Value})
+	}
+	*m = rules
+	return nil
+}
+
+func (m MappingKeys) MarshalYAML() (any, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, r := range m {
+		node.Content = append(node.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: r.From},
+			&yaml.Node{Kind: yaml.ScalarNode, Value: r.To})
+	}
+	return node, nil
+}
+
+// IsZero reports whether the mapping leaves keys unchanged.
+func (m KeyMapping) IsZero() bool {
+	return !m.Normalize && len(m.Keys) == 0
+}
+
+func (r MappingRule) isPattern() bool {
+	return strings.Contains(r.From, "*")
+}
+
+var captureRef = regexp.MustCompile(`\$(\d+)`)
+
+// compile turns a glob into an anchored regexp with one group per wildcard.
+func (r MappingRule) compile() (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(r.From); i++ {
+		switch {
+		case strings.HasPrefix(r.From[i:], "**"):
+			b.WriteString("(.+)")
+			i++
+		case r.From[i] == '*':
+			b.WriteString("([^/]+)")
+		default:
+			b.WriteString(regexp.QuoteMeta(r.From[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+func (m KeyMapping) validate() error {
+	seen := map[string]bool{}
+	for _, r := range m.Keys {
+		if r.From == "" || r.To == "" {
+			return fmt.Errorf("mapping %q: provider key and env var name are required", r.From)
+		}
+		if seen[r.From] {
+			return fmt.Errorf("mapping %q declared more than once", r.From)
+		}
+		seen[r.From] = true
+		re, err := r.compile()
+		if err != nil {
+			return fmt.Errorf("mapping %q: %w", r.From, err)
+		}
+		for _, ref := range captureRef.FindAllStringSubmatch(r.To, -1) {
+			if n, _ := strconv.Atoi(ref[1]); n < 1 || n > re.NumSubexp() {
+				return fmt.Errorf("mapping %q: %s has no matching wildcard", r.From, ref[0])
+			}
+		}
+	}
+	return nil
+}
+
+// EnvName returns the env var name for a provider key.
+func (m KeyMapping) EnvName(key string) string {
+	for _, r := range m.Keys {
+		if !r.isPattern() && r.From == key {
+			return r.To
+		}
+	}
+	for _, r := range m.Keys {
+		if !r.isPattern() {
+			continue
+		}
+		re, err := r.compile()
+		if err != nil {
+			continue
+		}
+		match := re.FindStringSubmatch(key)
+		if match == nil {
+			continue
+		}
+		return captureRef.ReplaceAllStringFunc(r.To, func(ref string) string {
+			n, _ := strconv.Atoi(ref[1:])
+			if m.Normalize {
+				return NormalizeKey(match[n])
+			}
+			return match[n]
+		})
+	}
+	if m.Normalize {
+		return NormalizeKey(key)
+	}
+	return key
+}
+
+// ProviderKey returns the provider key for an env var name. Keys already in
+// the provider are matched through EnvName; otherwise the first rule whose
+// target fits is inverted, and normalized names become lower-case paths.
+func (m KeyMapping) ProviderKey(name string, existing []string) string {
+	if m.IsZero() {
+		return name
+	}
+	sort.Strings(existing)
+	for _, key := range existing {
+		if m.EnvName(key) == name {
+			return key
+		}
+	}
+	for _, r := range m.Keys {
+		if !r.isPattern() && r.To == name {
+			return r.From
+		}
+	}
+	for _, r := range m.Keys {
+		if !r.isPattern() {
+			continue
+		}
+		if key, ok := r.invert(name, m.Normalize); ok {
+			return key
+		}
+	}
+	if m.Normalize {
+		return denormalizeKey(name)
+	}
+	return name
+}
+
+// invert fills the rule's wildcards from an env var name matching To.
+func (r MappingRule) invert(name string, normalized bool) (string, bool) {
+	var b strings.Builder
+	b.WriteString("^")
+	order := []int{}
+	last := 0
+	for _, loc := range captureRef.FindAllStringSubmatchIndex(r.To, -1) {
+		b.WriteString(regexp.QuoteMeta(r.To[last:loc[0]]))
+		b.WriteString("(.+?)")
+		n, _ := strconv.Atoi(r.To[loc[2]:loc[3]])
+		order = append(order, n)
+		last = loc[1]
+	}
+	b.WriteString(regexp.QuoteMeta(r.To[last:]))
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return "", false
+	}
+	match := re.FindStringSubmatch(name)
+	if match == nil {
+		return "", false
+	}
+	captures := map[int]string{}
+	for i, n := range order {
+		captures[n] = match[i+1]
+		if normalized {
+			captures[n] = denormalizeKey(match[i+1])
+		}
+	}
+	var out strings.Builder
+	wildcard := 0
+	for i := 0; i < len(r.From); i++ {
+		if r.From[i] != '*' {
+			out.WriteByte(r.From[i])
+			continue
+		}
+		if strings.HasPrefix(r.From[i:], "**") {
+			i++
+		}
+		wildcard++
+		c, ok := captures[wildcard]
+		if !ok {
+			return "", false
+		}
+		out.WriteString(c)
+	}
+	return out.String(), true
+}
+
+// NormalizeKey turns a provider key such as db/password or api.key into an
+// upper snake case env var name.
+func NormalizeKey(key string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range key {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if underscore && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			underscore = false
+			b.WriteRune(unicode.ToUpper(r))
+			continue
+		}
+		underscore = true
+	}
+	return b.String()
+}
+
+func denormalizeKey(name string) string {
+	return strings.ReplaceAll(strings.ToLower(name), "_", "/")
+}
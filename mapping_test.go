@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/binsquare/envmap/provider"
+	"gopkg.in/yaml.v3"
+)
+
+func TestNormalizeKey(t *testing.T) {
+	tests := map[string]string{
+		"db/password":     "DB_PASSWORD",
+		"/app/prod/db/pw": "APP_PROD_DB_PW",
+		"api.key":         "API_KEY",
+		"stripe-secret":   "STRIPE_SECRET",
+		"ALREADY_SNAKE":   "ALREADY_SNAKE",
+		"a//b--c":         "A_B_C",
+	}
+	for in, want := range tests {
+		if got := NormalizeKey(in); got != want {
+			t.Errorf("NormalizeKey(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestKeyMappingEnvName(t *testing.T) {
+	var m KeyMapping
+	src := `
+normalize: true
+keys:
+  db/password: DATABASE_PASSWORD
+  "stripe/*": STRIPE_$1
+  "feature/**": FLAG_$1
+  "db/*": DB_$1
+`
+	if err := yaml.Unmarshal([]byte(src), &m); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.validate(); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"db/password":      "DATABASE_PASSWORD", // exact wins over db/*
+		"db/host":          "DB_HOST",
+		"stripe/live-key":  "STRIPE_LIVE_KEY",
+		"feature/ui/theme": "FLAG_UI_THEME",
+		"other/thing":      "OTHER_THING",
+	}
+	for in, want := range tests {
+		if got := m.EnvName(in); got != want {
+			t.Errorf("EnvName(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	if got := (KeyMapping{}).EnvName("db/password"); got != "db/password" {
+		t.Errorf("zero mapping renamed key to %q", got)
+	}
+}
+
+func TestKeyMappingProviderKey(t *testing.T) {
+	m := KeyMapping{Normalize: true, Keys: MappingKeys{
+		{From: "db/password", To: "DATABASE_PASSWORD"},
+		{From: "stripe/*", To: "STRIPE_$1"},
+	}}
+	existing := []string{"stripe/live-key", "cache/ttl-seconds"}
+	tests := map[string]string{
+		"DATABASE_PASSWORD": "db/password",
+		"STRIPE_LIVE_KEY":   "stripe/live-key",   // found among existing keys
+		"CACHE_TTL_SECONDS": "cache/ttl-seconds", // found among existing keys
+		"STRIPE_WEBHOOK":    "stripe/webhook",    // inverted from the pattern
+		"NEW_KEY":           "new/key",           // denormalized
+	}
+	for in, want := range tests {
+		if got := m.ProviderKey(in, existing); got != want {
+			t.Errorf("ProviderKey(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestKeyMappingValidate(t *testing.T) {
+	bad := []KeyMapping{
+		{Keys: MappingKeys{{From: "a/*", To: "A_$2"}}},
+		{Keys: MappingKeys{{From: "a", To: ""}}},
+		{Keys: MappingKeys{{From: "a", To: "A"}, {From: "a", To: "B"}}},
+	}
+	for _, m := range bad {
+		if err := m.validate(); err == nil {
+			t.Errorf("validate(%+v) = nil, want error", m)
+		}
+	}
+}
+
+func TestCollectEnvAppliesMapping(t *testing.T) {
+	projectCfg, globalCfg := localTestConfig(t)
+	ctx := context.Background()
+	raw := EnvConfig{Provider: "local", Prefix: "app/prod/"}
+	projectCfg.Envs["raw"] = raw
+	mapped := raw
+	mapped.Mapping = KeyMapping{Normalize: true, Keys: MappingKeys{{From: "db/password", To: "DATABASE_PASSWORD"}}}
+	projectCfg.Envs["prod"] = mapped
+
+	if err := WriteSecret(ctx, projectCfg, globalCfg, "raw", "db/password", "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteSecret(ctx, projectCfg, globalCfg, "raw", "db/host", "db.internal"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := CollectEnv(ctx, projectCfg, globalCfg, "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["DATABASE_PASSWORD"] != "s3cret" || got["DB_HOST"] != "db.internal" || len(got) != 2 {
+		t.Errorf("mapped env = %v", got)
+	}
+
+	// set through the mapped env writes the existing provider key.
+	if err := WriteSecret(ctx, projectCfg, globalCfg, "prod", "DB_HOST", "localhost"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := FetchSecret(ctx, projectCfg, globalCfg, "raw", "db/host"); v != "localhost" {
+		t.Errorf("raw db/host = %q, want localhost", v)
+	}
+	if v, err := FetchSecret(ctx, projectCfg, globalCfg, "prod", "DB_HOST"); err != nil || v != "localhost" {
+		t.Errorf("FetchSecret(prod, DB_HOST) = %q, %v", v, err)
+	}
+
+	if err := WriteSecret(ctx, projectCfg, globalCfg, "raw", "DB_HOST", "dup"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CollectEnv(ctx, projectCfg, globalCfg, "prod"); err == nil || !strings.Contains(err.Error(), "both map to DB_HOST") {
+		t.Errorf("CollectEnv error = %v, want collision", err)
+	}
+}
+
+// listCounter counts List calls on a wrapped provider.
+type listCounter struct {
+	provider.Provider
+	lists int
+}
+
+func (c *listCounter) List(ctx context.Context, prefix string) (map[string]string, error) {
+	c.lists++
+	return c.Provider.List(ctx, prefix)
+}
+
+func TestEnvWriterListsOnce(t *testing.T) {
+	projectCfg, globalCfg := localTestConfig(t)
+	ctx := context.Background()
+	env := projectCfg.Envs["dev"]
+	env.Mapping = KeyMapping{Normalize: true}
+	projectCfg.Envs["dev"] = env
+
+	w, err := openEnvWriter(ctx, projectCfg, globalCfg, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter := &listCounter{Provider: w.p}
+	w.p = counter
+	for _, kv := range [][2]string{{"DB_HOST", "db.internal"}, {"DB_USER", "app"}, {"DB_HOST", "localhost"}} {
+		if err := w.Set(ctx, kv[0], kv[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if counter.lists != 0 {
+		t.Errorf("Set listed the provider %d times, want the keys listed once when the writer opened", counter.lists)
+	}
+	got, err := CollectEnv(ctx, projectCfg, globalCfg, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["DB_HOST"] != "localhost" || got["DB_USER"] != "app" || len(got) != 2 {
+		t.Errorf("env = %v, want DB_HOST=localhost and DB_USER=app", got)
+	}
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"golang.org/x/term"
 	"os"
+
+	"github.com/binsquare/envmap/provider"
+	"golang.org/x/term"
 )
 
 func readSecretFromPrompt(label string) (string, error) {
@@ -15,3 +18,63 @@ func readSecretFromPrompt(label string) (string, error) {
 	}
 	return string(b), nil
 }
+
+// promptsDisabled makes withPromptedPassphrase fail instead of prompting,
+// for callers such as the shell hook that must not block on the terminal.
+var promptsDisabled bool
+
+// promptedPassphrases caches passphrases entered during this process so
+// commands that open a provider several times only prompt once.
+var promptedPassphrases = map[string]string{}
+
+// withPromptedPassphrase fills in the passphrase for passphrase-encrypted
+// providers whose key_env is unset, prompting when stdin is a terminal.
+// Otherwise the config is returned unchanged and the provider reports
+// the missing passphrase.
+func withPromptedPassphrase(providerName string, cfg provider.ProviderConfig) (provider.ProviderConfig, error) {
+	enc := cfg.Encryption
+	if !enc.IsPassphrase() || enc.Passphrase != "" {
+		return cfg, nil
+	}
+	if enc.KeyEnv != "" && os.Getenv(enc.KeyEnv) != "" {
+		return cfg, nil
+	}
+	passphrase, ok := promptedPassphrases[providerName]
+	if !ok {
+		if promptsDisabled {
+			return cfg, fmt.Errorf("provider %s needs a passphrase and prompting is disabled; set encryption.key_env and export that variable", providerName)
+		}
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return cfg, nil
+		}
+		var err error
+		_, statErr := os.Stat(cfg.Path)
+		passphrase, err = readPassphrase(fmt.Sprintf("Passphrase for %s: ", providerName), errors.Is(statErr, os.ErrNotExist))
+		if err != nil {
+			return cfg, err
+		}
+		promptedPassphrases[providerName] = passphrase
+	}
+	withPass := *enc
+	withPass.Passphrase = passphrase
+	cfg.Encryption = &withPass
+	return cfg, nil
+}
+
+// readPassphrase prompts for a passphrase, asking twice when confirm is set.
+func readPassphrase(label string, confirm bool) (string, error) {
+	passphrase, err := readSecretFromPrompt(label)
+	if err != nil {
+		return "", err
+	}
+	if confirm {
+		again, err := readSecretFromPrompt("Confirm passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if again != passphrase {
+			return "", errors.New("passphrases do not match")
+		}
+	}
+	return passphrase, nil
+}
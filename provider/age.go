@@ -0,0 +1,291 @@
+package provider
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// EncryptionTypeAge encrypts the store's data key to a list of age X25519 recipients.
+const EncryptionTypeAge = "age"
+
+// ageParams is the header payload for age stores: the recipient list (kept in
+// clear so it can be shown and edited) and the data key wrapped to them.
+type ageParams struct {
+	Recipients []string `json:"recipients"`
+	DataKey    []byte   `json:"data_key"`
+}
+
+func newAgeKeySource(cfg *EncryptionConfig) (*keySource, error) {
+	identities, err := loadAgeIdentities(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range cfg.Recipients {
+		if _, err := age.ParseX25519Recipient(r); err != nil {
+			return nil, fmt.Errorf("invalid age recipient %q: %w", r, err)
+		}
+	}
+	return &keySource{kdf: kdfAge, identities: identities, recipients: cfg.Recipients}, nil
+}
+
+func loadAgeIdentities(cfg *EncryptionConfig) ([]age.Identity, error) {
+	var raw string
+	switch {
+	case cfg.KeyEnv != "":
+		raw = os.Getenv(cfg.KeyEnv)
+		if raw == "" {
+			return nil, fmt.Errorf("key env var %s is empty or not set", cfg.KeyEnv)
+		}
+	case cfg.IdentityFile != "":
+		info, err := os.Stat(cfg.IdentityFile)
+		if err != nil {
+			return nil, fmt.Errorf("stat identity file: %w", err)
+		}
+		if info.Mode().Perm()&0o077 != 0 {
+			return nil, fmt.Errorf("identity file %s is too permissive (%#o); run: chmod 600 %s", cfg.IdentityFile, info.Mode().Perm(), cfg.IdentityFile)
+		}
+		data, err := os.ReadFile(cfg.IdentityFile)
+		if err != nil {
+			return nil, fmt.Errorf("read identity file: %w", err)
+		}
+		raw = string(data)
+	default:
+		return nil, errors.New("age encryption requires encryption.identity_file or encryption.key_env")
+	}
+	identities, err := age.ParseIdentities(strings.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("parse age identity: %w", err)
+	}
+	return identities, nil
+}
+
+// wrapAgeDataKey encrypts dataKey to recipients and returns the header params.
+func wrapAgeDataKey(dataKey []byte, recipients []string) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("age encryption requires at least one recipient")
+	}
+	parsed := make([]age.Recipient, 0, len(recipients))
+	for _, r := range recipients {
+		rcpt, err := age.ParseX25519Recipient(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid age recipient %q: %w", r, err)
+		}
+		parsed = append(parsed, rcpt)
+	}
+	var wrapped bytes.Buffer
+	w, err := age.Encrypt(&wrapped, parsed...)
+	if err != nil {
+		return nil, fmt.Errorf("wrap data key: %w", err)
+	}
+	if _, err := w.Write(dataKey); err != nil {
+		return nil, fmt.Errorf("wrap data key: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("wrap data key: %w", err)
+	}
+	return json.Marshal(ageParams{Recipients: recipients, DataKey: wrapped.Bytes()})
+}
+
+func parseAgeParams(b []byte) (ageParams, error) {
+	var p ageParams
+	if err := json.Unmarshal(b, &p); err != nil {
+		return p, fmt.Errorf("invalid age parameters in store header: %w", err)
+	}
+	return p, nil
+}
+
+func (s *keySource) unwrapAgeDataKey(params ageParams) ([]byte, error) {
+	r, err := age.Decrypt(bytes.NewReader(params.DataKey), s.identities...)
+	if err != nil {
+		var noMatch *age.NoIdentityMatchError
+		if errors.As(err, &noMatch) {
+			return nil, fmt.Errorf("none of your age identities is a recipient of this store; ask a current recipient to run: envmap recipients add %s", s.publicKeyHint())
+		}
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+	dataKey, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+	if len(dataKey) != 32 {
+		return nil, errors.New("unwrapped data key has unexpected length")
+	}
+	return dataKey, nil
+}
+
+// newAgeHeader creates a fresh data key wrapped to recipients.
+func (s *keySource) newAgeHeader(recipients []string) (envelopeHeader, []byte, error) {
+	if !s.canReadAs(recipients) {
+		return envelopeHeader{}, nil, fmt.Errorf("your age identity (%s) is not in the recipient list; you would be unable to read the store", s.publicKeyHint())
+	}
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return envelopeHeader{}, nil, err
+	}
+	params, err := wrapAgeDataKey(dataKey, recipients)
+	if err != nil {
+		return envelopeHeader{}, nil, err
+	}
+	h := envelopeHeader{Version: envelopeVersion, KDF: kdfAge, Params: params, Salt: []byte{}, KeyID: keyID(dataKey)}
+	s.cache(h, dataKey)
+	return h, dataKey, nil
+}
+
+// canReadAs reports whether one of the loaded X25519 identities is among recipients.
+func (s *keySource) canReadAs(recipients []string) bool {
+	for _, id := range s.identities {
+		x, ok := id.(*age.X25519Identity)
+		if !ok {
+			continue
+		}
+		for _, r := range recipients {
+			if x.Recipient().String() == r {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *keySource) publicKeyHint() string {
+	for _, id := range s.identities {
+		if x, ok := id.(*age.X25519Identity); ok {
+			return x.Recipient().String()
+		}
+	}
+	return "<your age public key>"
+}
+
+// StoreRecipients returns the age recipients the local store at path is encrypted to.
+// Recipient management applies to local-file stores only; a project file keeps
+// the recipients it was created with.
+func StoreRecipients(path string, enc *EncryptionConfig) ([]string, error) {
+	store, err := openAgeStore(path, enc)
+	if err != nil {
+		return nil, err
+	}
+	var recipients []string
+	err = store.withExclusiveLock(func() error {
+		if _, err := store.readAllUnlocked(); err != nil {
+			return err
+		}
+		params, _, err := store.keys.cachedAgeParams()
+		if err != nil {
+			return err
+		}
+		recipients = params.Recipients
+		return nil
+	})
+	return recipients, err
+}
+
+// AddRecipients re-wraps the store's existing data key to include recipients.
+// Secrets are re-sealed under the same data key; no values need re-entering.
+func AddRecipients(path string, enc *EncryptionConfig, add []string) ([]string, error) {
+	return updateRecipients(path, enc, func(current []string) ([]string, bool) {
+		next := append([]string(nil), current...)
+		for _, r := range add {
+			if !containsString(next, r) {
+				next = append(next, r)
+			}
+		}
+		return next, false
+	})
+}
+
+// RemoveRecipients drops recipients and moves the store to a fresh data key,
+// so a removed recipient who kept the old data key cannot read later writes.
+func RemoveRecipients(path string, enc *EncryptionConfig, remove []string) ([]string, error) {
+	return updateRecipients(path, enc, func(current []string) ([]string, bool) {
+		next := make([]string, 0, len(current))
+		for _, r := range current {
+			if !containsString(remove, r) {
+				next = append(next, r)
+			}
+		}
+		return next, true
+	})
+}
+
+func updateRecipients(path string, enc *EncryptionConfig, update func([]string) ([]string, bool)) ([]string, error) {
+	store, err := openAgeStore(path, enc)
+	if err != nil {
+		return nil, err
+	}
+	var next []string
+	err = store.withExclusiveLock(func() error {
+		entries, err := store.readAllUnlocked()
+		if err != nil {
+			return err
+		}
+		params, dataKey, err := store.keys.cachedAgeParams()
+		if err != nil {
+			return err
+		}
+		var newDataKey bool
+		next, newDataKey = update(params.Recipients)
+		if len(next) == 0 {
+			return errors.New("refusing to remove every recipient; the store would become unreadable")
+		}
+		if newDataKey {
+			if _, _, err := store.keys.newAgeHeader(next); err != nil {
+				return err
+			}
+		} else {
+			if !store.keys.canReadAs(next) {
+				return fmt.Errorf("your age identity (%s) is not in the recipient list", store.keys.publicKeyHint())
+			}
+			wrapped, err := wrapAgeDataKey(dataKey, next)
+			if err != nil {
+				return err
+			}
+			store.keys.cache(envelopeHeader{Version: envelopeVersion, KDF: kdfAge, Params: wrapped, Salt: []byte{}, KeyID: keyID(dataKey)}, dataKey)
+		}
+		return store.writeAllUnlocked(entries)
+	})
+	return next, err
+}
+
+func openAgeStore(path string, enc *EncryptionConfig) (*localFile, error) {
+	if enc == nil || enc.Type != EncryptionTypeAge {
+		return nil, errors.New("recipients can only be managed for stores with encryption.type: age")
+	}
+	p, err := newLocalFile(EnvConfig{}, ProviderConfig{Path: path, Encryption: enc})
+	if err != nil {
+		return nil, err
+	}
+	store := p.(*localFile)
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("local store %s: %w", path, err)
+	}
+	return store, nil
+}
+
+// cachedAgeParams returns the recipients and data key of the header read last.
+func (s *keySource) cachedAgeParams() (ageParams, []byte, error) {
+	s.mu.Lock()
+	h, key := s.cachedHdr, s.cachedKey
+	s.mu.Unlock()
+	if h.KDF != kdfAge {
+		return ageParams{}, nil, errors.New("store is not encrypted to age recipients")
+	}
+	params, err := parseAgeParams(h.Params)
+	return params, key, err
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -14,24 +14,47 @@ import (
 
 func init() {
 	Register(Info{
-		Type:           "aws-secretsmanager",
-		Description:    "AWS Secrets Manager",
-		Factory:        newAWSSecretsManager,
-		RequiredFields: []string{"region"},
-		OptionalFields: []string{"profile"},
+		Type:        "aws-secretsmanager",
+		Description: "AWS Secrets Manager",
+		Factory:     newAWSSecretsManager,
+		Fields: append(append([]Field(nil), awsFields...),
+			Field{Name: "recovery_window_days", Type: FieldInt},
+			Field{Name: "force_delete", Type: FieldBool, Default: false},
+		),
+		Capabilities: Capabilities{CapRead, CapWrite, CapDelete},
 	})
 }
 
 type awsSecretsManager struct {
-	envCfg      EnvConfig
-	providerCfg ProviderConfig
+	envCfg             EnvConfig
+	providerCfg        ProviderConfig
+	recoveryWindowDays int64
+	forceDelete        bool
 }
 
 func newAWSSecretsManager(envCfg EnvConfig, providerCfg ProviderConfig) (Provider, error) {
 	if providerCfg.Region == "" {
 		return nil, fmt.Errorf("aws-secretsmanager provider missing region")
 	}
-	return &awsSecretsManager{envCfg: envCfg, providerCfg: providerCfg}, nil
+	p := &awsSecretsManager{envCfg: envCfg, providerCfg: providerCfg}
+	if v, ok := providerCfg.Extra["recovery_window_days"]; ok {
+		days, ok := v.(int)
+		if !ok || days < 7 || days > 30 {
+			return nil, fmt.Errorf("aws-secretsmanager recovery_window_days must be between 7 and 30, got %v", v)
+		}
+		p.recoveryWindowDays = int64(days)
+	}
+	if v, ok := providerCfg.Extra["force_delete"]; ok {
+		force, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("aws-secretsmanager force_delete must be true or false, got %v", v)
+		}
+		p.forceDelete = force
+	}
+	if p.forceDelete && p.recoveryWindowDays != 0 {
+		return nil, fmt.Errorf("aws-secretsmanager: set either recovery_window_days or force_delete, not both")
+	}
+	return p, nil
 }
 
 func (p *awsSecretsManager) Get(ctx context.Context, name string) (string, error) {
@@ -142,6 +165,29 @@ func (p *awsSecretsManager) Set(ctx context.Context, name, value string) error {
 	return nil
 }
 
+// Delete schedules the secret for deletion after the configured recovery
+// window (AWS default: 30 days), or deletes it immediately with force_delete.
+func (p *awsSecretsManager) Delete(ctx context.Context, name string) error {
+	client, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	secretName := ApplyPrefix(p.envCfg, name)
+	input := &secretsmanager.DeleteSecretInput{
+		SecretId: aws.String(secretName),
+	}
+	if p.forceDelete {
+		input.ForceDeleteWithoutRecovery = aws.Bool(true)
+	} else if p.recoveryWindowDays != 0 {
+		input.RecoveryWindowInDays = aws.Int64(p.recoveryWindowDays)
+	}
+	if _, err := client.DeleteSecret(ctx, input); err != nil {
+		return fmt.Errorf("aws secrets delete %s: %w", secretName, err)
+	}
+	return nil
+}
+
 func (p *awsSecretsManager) client(ctx context.Context) (*secretsmanager.Client, error) {
 	opts := []func(*config.LoadOptions) error{
 		config.WithRegion(p.providerCfg.Region),
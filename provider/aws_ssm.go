@@ -12,11 +12,11 @@ import (
 
 func init() {
 	Register(Info{
-		Type:           "aws-ssm",
-		Description:    "AWS Systems Manager Parameter Store",
-		Factory:        newAWSSSM,
-		RequiredFields: []string{"region"},
-		OptionalFields: []string{"profile"},
+		Type:         "aws-ssm",
+		Description:  "AWS Systems Manager Parameter Store",
+		Factory:      newAWSSSM,
+		Fields:       awsFields,
+		Capabilities: Capabilities{CapRead, CapWrite, CapDelete, CapBatch},
 	})
 }
 
@@ -102,6 +102,20 @@ func (p *awsSSM) Set(ctx context.Context, name, value string) error {
 	return nil
 }
 
+func (p *awsSSM) Delete(ctx context.Context, name string) error {
+	client, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = client.DeleteParameter(ctx, &ssm.DeleteParameterInput{
+		Name: aws.String(name),
+	})
+	if err != nil {
+		return fmt.Errorf("aws ssm delete %s: %w", name, err)
+	}
+	return nil
+}
+
 func (p *awsSSM) client(ctx context.Context) (*ssm.Client, error) {
 	opts := []func(*config.LoadOptions) error{
 		config.WithRegion(p.providerCfg.Region),
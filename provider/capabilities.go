@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Capability names an operation or feature a provider supports.
+type Capability string
+
+const (
+	// CapRead means Get and List return secret values.
+	CapRead Capability = "read"
+	// CapWrite means Set creates or updates secrets.
+	CapWrite Capability = "write"
+	// CapDelete means the provider implements Deleter.
+	CapDelete Capability = "delete"
+	// CapMetadata means the provider implements MetadataLister.
+	CapMetadata Capability = "metadata"
+	// CapVersions means the provider implements Versioner.
+	CapVersions Capability = "versions"
+	// CapBatch means List fetches values in bulk rather than one request per secret.
+	CapBatch Capability = "batch"
+	// CapWatch means the provider can push change notifications.
+	CapWatch Capability = "watch"
+)
+
+// AllCapabilities lists every capability in display order.
+var AllCapabilities = []Capability{CapRead, CapWrite, CapDelete, CapMetadata, CapVersions, CapBatch, CapWatch}
+
+// Capabilities is a set of supported capabilities.
+type Capabilities []Capability
+
+// Has reports whether c includes want.
+func (c Capabilities) Has(want Capability) bool {
+	for _, got := range c {
+		if got == want {
+			return true
+		}
+	}
+	return false
+}
+
+// String renders the set in display order, e.g. "read, write, delete".
+func (c Capabilities) String() string {
+	names := make([]string, 0, len(c))
+	for _, capability := range AllCapabilities {
+		if c.Has(capability) {
+			names = append(names, string(capability))
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// CapabilityReporter is implemented by providers whose capabilities differ
+// from what their method set suggests (e.g. a Set that always fails).
+type CapabilityReporter interface {
+	Capabilities() Capabilities
+}
+
+// CapabilitiesOf returns what a provider instance supports, preferring its
+// own report and otherwise inferring from the optional interfaces it
+// implements. Batch and watch cannot be inferred; Info.Capabilities carries
+// the full declared set for a provider type.
+func CapabilitiesOf(p Provider) Capabilities {
+	if r, ok := p.(CapabilityReporter); ok {
+		return r.Capabilities()
+	}
+	caps := Capabilities{CapRead, CapWrite}
+	if _, ok := p.(Deleter); ok {
+		caps = append(caps, CapDelete)
+	}
+	if _, ok := p.(MetadataLister); ok {
+		caps = append(caps, CapMetadata)
+	}
+	if _, ok := p.(Versioner); ok {
+		caps = append(caps, CapVersions)
+	}
+	sort.SliceStable(caps, func(i, j int) bool { return capabilityIndex(caps[i]) < capabilityIndex(caps[j]) })
+	return caps
+}
+
+// RequireCapabilities returns an error naming the first missing capability.
+func RequireCapabilities(p Provider, providerName string, want ...Capability) error {
+	caps := CapabilitiesOf(p)
+	for _, w := range want {
+		if !caps.Has(w) {
+			return fmt.Errorf("provider %s does not support %s (supports: %s)", providerName, w, caps)
+		}
+	}
+	return nil
+}
+
+func capabilityIndex(c Capability) int {
+	for i, known := range AllCapabilities {
+		if known == c {
+			return i
+		}
+	}
+	return len(AllCapabilities)
+}
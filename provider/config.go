@@ -21,9 +21,30 @@ type ProviderConfig struct {
 
 // EncryptionConfig holds encryption settings for local file storage.
 type EncryptionConfig struct {
-	Type    string `yaml:"type"`
+	Type    string `yaml:"type,omitempty"`
 	KeyFile string `yaml:"key_file,omitempty"`
 	KeyEnv  string `yaml:"key_env,omitempty"`
+
+	// Argon2id cost parameters for type: passphrase; zero values use defaults.
+	KDFTime    uint32 `yaml:"kdf_time,omitempty"`
+	KDFMemory  uint32 `yaml:"kdf_memory,omitempty"` // KiB
+	KDFThreads uint8  `yaml:"kdf_threads,omitempty"`
+
+	// For type: age, new stores are encrypted to Recipients (age1... public keys)
+	// and read with the identity in IdentityFile or KeyEnv.
+	Recipients   []string `yaml:"recipients,omitempty"`
+	IdentityFile string   `yaml:"identity_file,omitempty"`
+
+	// Passphrase is supplied at runtime (e.g. from a prompt) and never read from or written to config.
+	Passphrase string `yaml:"-"`
+}
+
+// EncryptionTypePassphrase derives the store key from a human passphrase with Argon2id.
+const EncryptionTypePassphrase = "passphrase"
+
+// IsPassphrase reports whether the store key is derived from a passphrase.
+func (e *EncryptionConfig) IsPassphrase() bool {
+	return e != nil && e.Type == EncryptionTypePassphrase
 }
 
 // ApplyPrefix builds the fully-qualified secret name for a given key.
@@ -2,6 +2,7 @@ package provider
 
 import (
 	"bytes"
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -177,3 +178,203 @@ func TestLoadKeyMaterialPermissions(t *testing.T) {
 		t.Error("expected error for permissive key file")
 	}
 }
+
+func TestRotateKey(t *testing.T) {
+	dir := t.TempDir()
+	oldKey := filepath.Join(dir, "old")
+	newKey := filepath.Join(dir, "new")
+	if err := GenerateKeyFile(oldKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenerateKeyFile(newKey); err != nil {
+		t.Fatal(err)
+	}
+	storePath := filepath.Join(dir, "secrets.db")
+	oldCfg := &EncryptionConfig{KeyFile: oldKey}
+	newCfg := &EncryptionConfig{KeyFile: newKey}
+
+	p, err := newLocalFile(EnvConfig{}, ProviderConfig{Path: storePath, Encryption: oldCfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := p.Set(ctx, "API_KEY", "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RotateKey(storePath, oldCfg, newCfg); err != nil {
+		t.Fatalf("RotateKey: %v", err)
+	}
+
+	rotated, err := newLocalFile(EnvConfig{}, ProviderConfig{Path: storePath, Encryption: newCfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	val, err := rotated.Get(ctx, "API_KEY")
+	if err != nil {
+		t.Fatalf("Get with new key: %v", err)
+	}
+	if val != "s3cret" {
+		t.Errorf("value after rotation = %q, want %q", val, "s3cret")
+	}
+	if _, err := p.Get(ctx, "API_KEY"); err == nil {
+		t.Error("old key should no longer decrypt the store")
+	}
+}
+
+func TestEnvelopeRoundtrip(t *testing.T) {
+	src := newKeySource([]byte("envelope-key-material-32-bytes!!"))
+	plaintext := []byte(`{"KEY":{"value":"v"}}`)
+
+	sealed, err := sealEnvelope(plaintext, src)
+	if err != nil {
+		t.Fatalf("sealEnvelope: %v", err)
+	}
+	if !isEnvelope(sealed) {
+		t.Fatal("sealed data should start with the envelope magic")
+	}
+	h, _, err := parseEnvelopeHeader(sealed)
+	if err != nil {
+		t.Fatalf("parseEnvelopeHeader: %v", err)
+	}
+	if h.Version != envelopeVersion || h.KDF != kdfHKDFSHA256 || len(h.Salt) != envelopeSaltSize {
+		t.Errorf("unexpected header %+v", h)
+	}
+
+	opened, err := openEnvelope(sealed, src)
+	if err != nil {
+		t.Fatalf("openEnvelope: %v", err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("roundtrip = %q, want %q", opened, plaintext)
+	}
+
+	if _, err := openEnvelope(sealed, newKeySource([]byte("some-other-key-material"))); err == nil {
+		t.Error("openEnvelope with wrong key should fail")
+	}
+}
+
+func TestEnvelopeHeaderIsAuthenticated(t *testing.T) {
+	src := newKeySource([]byte("envelope-key-material-32-bytes!!"))
+	sealed, _ := sealEnvelope([]byte("secret"), src)
+
+	// Flip a salt byte: the header is bound as associated data.
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(envelopeMagic)+2+4+1] ^= 0xff
+	if _, err := openEnvelope(tampered, src); err == nil {
+		t.Error("tampered header should fail authentication")
+	}
+
+	newer := append([]byte(nil), sealed...)
+	newer[len(envelopeMagic)] = envelopeVersion + 1
+	if _, err := openEnvelope(newer, src); err == nil {
+		t.Error("newer format version should be rejected")
+	}
+}
+
+func TestLocalFileUpgradesLegacyStore(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "key")
+	if err := GenerateKeyFile(keyPath); err != nil {
+		t.Fatal(err)
+	}
+	material, _ := os.ReadFile(keyPath)
+	key, _ := deriveKey(material)
+	legacy, err := encrypt([]byte(`{"OLD":{"value":"legacy"}}`), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storePath := filepath.Join(dir, "secrets.db")
+	if err := os.WriteFile(storePath, legacy, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := newLocalFile(EnvConfig{}, ProviderConfig{Path: storePath, Encryption: &EncryptionConfig{KeyFile: keyPath}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if v, err := p.Get(ctx, "OLD"); err != nil || v != "legacy" {
+		t.Fatalf("Get from legacy store = %q, %v", v, err)
+	}
+	if err := p.Set(ctx, "NEW", "value"); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := os.ReadFile(storePath)
+	if !isEnvelope(raw) {
+		t.Error("store should be rewritten in the envelope format on write")
+	}
+	if v, err := p.Get(ctx, "OLD"); err != nil || v != "legacy" {
+		t.Errorf("Get after upgrade = %q, %v", v, err)
+	}
+}
+
+func TestPassphraseStore(t *testing.T) {
+	dir := t.TempDir()
+	storePath := filepath.Join(dir, "secrets.db")
+	t.Setenv("ENVMAP_TEST_PASSPHRASE", "correct horse battery staple")
+	// Cheap parameters keep the test fast; they are recorded in the header.
+	enc := &EncryptionConfig{Type: EncryptionTypePassphrase, KeyEnv: "ENVMAP_TEST_PASSPHRASE", KDFTime: 1, KDFMemory: 1024, KDFThreads: 1}
+
+	p, err := newLocalFile(EnvConfig{}, ProviderConfig{Path: storePath, Encryption: enc})
+	if err != nil {
+		t.Fatalf("newLocalFile: %v", err)
+	}
+	ctx := context.Background()
+	if err := p.Set(ctx, "KEY", "value"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	raw, _ := os.ReadFile(storePath)
+	h, _, err := parseEnvelopeHeader(raw)
+	if err != nil {
+		t.Fatalf("parseEnvelopeHeader: %v", err)
+	}
+	params, err := parseArgon2Params(h.Params)
+	if h.KDF != kdfArgon2id || err != nil || params != (argon2Params{Time: 1, Memory: 1024, Threads: 1}) {
+		t.Errorf("unexpected header kdf=%d params=%+v err=%v", h.KDF, params, err)
+	}
+
+	// A runtime passphrase (e.g. from a prompt) takes precedence over the env var.
+	prompted := *enc
+	prompted.Passphrase = "correct horse battery staple"
+	prompted.KeyEnv = ""
+	p2, err := newLocalFile(EnvConfig{}, ProviderConfig{Path: storePath, Encryption: &prompted})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := p2.Get(ctx, "KEY"); err != nil || v != "value" {
+		t.Errorf("Get with prompted passphrase = %q, %v", v, err)
+	}
+
+	wrong := prompted
+	wrong.Passphrase = "incorrect horse battery"
+	p3, err := newLocalFile(EnvConfig{}, ProviderConfig{Path: storePath, Encryption: &wrong})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p3.Get(ctx, "KEY"); err == nil {
+		t.Error("wrong passphrase should fail")
+	}
+
+	short := prompted
+	short.Passphrase = "short"
+	if _, err := newLocalFile(EnvConfig{}, ProviderConfig{Path: storePath, Encryption: &short}); err == nil {
+		t.Error("expected error for too-short passphrase")
+	}
+}
+
+func TestParseArgon2ParamsLimits(t *testing.T) {
+	for _, a := range []argon2Params{
+		{Time: maxArgon2Time + 1, Memory: 1024, Threads: 1},
+		{Time: 1, Memory: 0xffffffff, Threads: 1},
+		{Time: 1, Memory: 1024, Threads: 255},
+	} {
+		if _, err := parseArgon2Params(a.marshal()); err == nil {
+			t.Errorf("parseArgon2Params accepted %+v", a)
+		}
+	}
+	if _, err := parseArgon2Params(defaultArgon2Params.marshal()); err != nil {
+		t.Errorf("default parameters rejected: %v", err)
+	}
+}
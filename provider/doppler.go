@@ -5,21 +5,30 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
+	"net/url"
 )
 
 func init() {
 	Register(Info{
-		Type:           "doppler",
-		Description:    "Doppler SecretOps Platform",
-		Factory:        newDoppler,
-		RequiredFields: []string{"project", "config"},
-		OptionalFields: []string{"token"},
+		Type:         "doppler",
+		Description:  "Doppler SecretOps Platform",
+		Factory:      newDoppler,
+		Fields:       dopplerFields,
+		Capabilities: dopplerCapabilities,
 	})
 }
 
 const dopplerAPIBase = "https://api.doppler.com/v3"
 
+var dopplerFields = []Field{
+	{Name: "project", Type: FieldString, Required: true},
+	{Name: "config", Type: FieldString, Required: true},
+	{Name: "token", Type: FieldString, Required: true, Env: "DOPPLER_TOKEN", Secret: true},
+}
+
+// Doppler secrets are written with the Doppler CLI, so Set is unsupported.
+var dopplerCapabilities = Capabilities{CapRead, CapDelete, CapBatch}
+
 type doppler struct {
 	token       string
 	project     string
@@ -33,20 +42,18 @@ func newDoppler(envCfg EnvConfig, providerCfg ProviderConfig) (Provider, error)
 		providerCfg.Extra = map[string]any{}
 	}
 
-	project, ok := providerCfg.Extra["project"].(string)
-	if !ok || project == "" {
+	values := newConfigValues(dopplerFields, providerCfg)
+	project := values.String("project")
+	if project == "" {
 		return nil, fmt.Errorf("doppler provider requires project in config")
 	}
 
-	cfg, ok := providerCfg.Extra["config"].(string)
-	if !ok || cfg == "" {
+	cfg := values.String("config")
+	if cfg == "" {
 		return nil, fmt.Errorf("doppler provider requires config in config")
 	}
 
-	token := os.Getenv("DOPPLER_TOKEN")
-	if t, ok := providerCfg.Extra["token"].(string); ok && t != "" {
-		token = t
-	}
+	token := values.String("token")
 	if token == "" {
 		return nil, fmt.Errorf("doppler provider requires DOPPLER_TOKEN env or token in config")
 	}
@@ -60,6 +67,10 @@ func newDoppler(envCfg EnvConfig, providerCfg ProviderConfig) (Provider, error)
 	}, nil
 }
 
+func (p *doppler) Capabilities() Capabilities {
+	return dopplerCapabilities
+}
+
 func (p *doppler) doRequest(ctx context.Context, method, path string) (*http.Response, error) {
 	url := dopplerAPIBase + path
 
@@ -121,6 +132,22 @@ func (p *doppler) List(ctx context.Context, prefix string) (map[string]string, e
 	return out, nil
 }
 
+func (p *doppler) Delete(ctx context.Context, name string) error {
+	key := ApplyPrefix(p.envCfg, name)
+	path := fmt.Sprintf("/configs/config/secret?project=%s&config=%s&name=%s", url.QueryEscape(p.project), url.QueryEscape(p.config), url.QueryEscape(key))
+
+	resp, err := p.doRequest(ctx, http.MethodDelete, path)
+	if err != nil {
+		return fmt.Errorf("doppler delete %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("doppler delete %s returned status %d", key, resp.StatusCode)
+	}
+	return nil
+}
+
 func (p *doppler) Set(ctx context.Context, name, value string) error {
 	return fmt.Errorf("doppler Set not implemented: use doppler CLI to set secrets")
 }
@@ -0,0 +1,353 @@
+package provider
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"filippo.io/age"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Local store files start with a self-describing header so the format can
+// evolve without breaking existing stores:
+//
+//	magic      "ENVMAP"   6 bytes
+//	version    uint8
+//	kdf        uint8      how the file key is derived from key material
+//	params     uint32 length + bytes, KDF-specific parameters
+//	salt       uint8 length + bytes
+//	key id     uint8 length + bytes, fingerprint of the key material
+//	body       nonce || AES-256-GCM ciphertext, with the header as associated data
+//
+// Files without the magic are legacy nonce||ciphertext written with deriveKey.
+const (
+	envelopeMagic   = "ENVMAP"
+	envelopeVersion = 1
+
+	kdfHKDFSHA256 byte = 1
+	kdfArgon2id   byte = 2
+	kdfAge        byte = 3 // random data key wrapped to age recipients
+
+	envelopeSaltSize = 16
+	keyIDSize        = 8
+)
+
+type envelopeHeader struct {
+	Version byte
+	KDF     byte
+	Params  []byte
+	Salt    []byte
+	KeyID   []byte
+}
+
+func (h envelopeHeader) marshal() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(envelopeMagic)
+	buf.WriteByte(h.Version)
+	buf.WriteByte(h.KDF)
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(h.Params)))
+	buf.Write(n[:])
+	buf.Write(h.Params)
+	buf.WriteByte(byte(len(h.Salt)))
+	buf.Write(h.Salt)
+	buf.WriteByte(byte(len(h.KeyID)))
+	buf.Write(h.KeyID)
+	return buf.Bytes()
+}
+
+// isEnvelope reports whether data starts with the envelope magic.
+func isEnvelope(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(envelopeMagic))
+}
+
+// parseEnvelopeHeader decodes the header and returns it with its encoded length.
+func parseEnvelopeHeader(data []byte) (envelopeHeader, int, error) {
+	var h envelopeHeader
+	r := bytes.NewReader(data)
+	if _, err := r.Seek(int64(len(envelopeMagic)), io.SeekStart); err != nil {
+		return h, 0, err
+	}
+	truncated := errors.New("truncated envelope header")
+	var err error
+	if h.Version, err = r.ReadByte(); err != nil {
+		return h, 0, truncated
+	}
+	if h.Version > envelopeVersion {
+		return h, 0, fmt.Errorf("store format version %d is newer than this envmap supports (%d); upgrade envmap", h.Version, envelopeVersion)
+	}
+	if h.KDF, err = r.ReadByte(); err != nil {
+		return h, 0, truncated
+	}
+	var n [4]byte
+	if _, err := io.ReadFull(r, n[:]); err != nil {
+		return h, 0, truncated
+	}
+	paramsLen := binary.BigEndian.Uint32(n[:])
+	if int64(paramsLen) > int64(r.Len()) {
+		return h, 0, truncated
+	}
+	h.Params = make([]byte, paramsLen)
+	if _, err := io.ReadFull(r, h.Params); err != nil {
+		return h, 0, truncated
+	}
+	if h.Salt, err = readShortField(r); err != nil {
+		return h, 0, truncated
+	}
+	if h.KeyID, err = readShortField(r); err != nil {
+		return h, 0, truncated
+	}
+	return h, len(data) - r.Len(), nil
+}
+
+func readShortField(r *bytes.Reader) ([]byte, error) {
+	n, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	field := make([]byte, n)
+	if _, err := io.ReadFull(r, field); err != nil {
+		return nil, err
+	}
+	return field, nil
+}
+
+// argon2Params are the Argon2id cost parameters stored in passphrase-mode headers.
+type argon2Params struct {
+	Time    uint32
+	Memory  uint32 // KiB
+	Threads uint8
+}
+
+// Defaults follow the second recommended option in RFC 9106.
+var defaultArgon2Params = argon2Params{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+func (a argon2Params) marshal() []byte {
+	buf := make([]byte, 9)
+	binary.BigEndian.PutUint32(buf[0:4], a.Time)
+	binary.BigEndian.PutUint32(buf[4:8], a.Memory)
+	buf[8] = a.Threads
+	return buf
+}
+
+func parseArgon2Params(b []byte) (argon2Params, error) {
+	if len(b) != 9 {
+		return argon2Params{}, fmt.Errorf("invalid argon2id parameters in store header")
+	}
+	a := argon2Params{
+		Time:    binary.BigEndian.Uint32(b[0:4]),
+		Memory:  binary.BigEndian.Uint32(b[4:8]),
+		Threads: b[8],
+	}
+	if a.Time == 0 || a.Memory == 0 || a.Threads == 0 {
+		return argon2Params{}, fmt.Errorf("invalid argon2id parameters in store header")
+	}
+	if err := a.checkLimits(); err != nil {
+		return argon2Params{}, fmt.Errorf("store header: %w", err)
+	}
+	return a, nil
+}
+
+// Upper bounds on Argon2id costs, so a corrupt or tampered header cannot make
+// envmap allocate or compute without limit. They sit well above the defaults.
+const (
+	maxArgon2Time    = 64
+	maxArgon2Memory  = 4 * 1024 * 1024 // KiB, 4 GiB
+	maxArgon2Threads = 64
+)
+
+func (a argon2Params) checkLimits() error {
+	switch {
+	case a.Time > maxArgon2Time:
+		return fmt.Errorf("argon2id time %d exceeds the maximum of %d", a.Time, maxArgon2Time)
+	case a.Memory > maxArgon2Memory:
+		return fmt.Errorf("argon2id memory %d KiB exceeds the maximum of %d KiB", a.Memory, maxArgon2Memory)
+	case a.Threads > maxArgon2Threads:
+		return fmt.Errorf("argon2id threads %d exceeds the maximum of %d", a.Threads, maxArgon2Threads)
+	}
+	return nil
+}
+
+// keySource is the secret envelope keys are derived from, plus the KDF used
+// for new writes. Reads always follow the KDF recorded in the file header.
+type keySource struct {
+	material []byte
+	kdf      byte
+	argon2   argon2Params
+
+	// age mode: identities unwrap the data key; recipients seed new stores.
+	identities []age.Identity
+	recipients []string
+
+	// Passphrase derivation is deliberately slow and age stores reuse their
+	// data key, so the last derived key is cached with the header it belongs to.
+	mu        sync.Mutex
+	cacheID   []byte
+	cachedKey []byte
+	cachedHdr envelopeHeader
+}
+
+func newKeySource(material []byte) *keySource {
+	return &keySource{material: material, kdf: kdfHKDFSHA256}
+}
+
+func newPassphraseKeySource(passphrase []byte, params argon2Params) *keySource {
+	return &keySource{material: passphrase, kdf: kdfArgon2id, argon2: params}
+}
+
+// sealEnvelope encrypts plaintext and prefixes the header.
+func sealEnvelope(plaintext []byte, src *keySource) ([]byte, error) {
+	h, key, err := src.headerForWrite()
+	if err != nil {
+		return nil, err
+	}
+	header := h.marshal()
+	body, err := sealAEAD(plaintext, key, header)
+	if err != nil {
+		return nil, err
+	}
+	return append(header, body...), nil
+}
+
+// openEnvelope decrypts data written by sealEnvelope, or a legacy headerless file.
+func openEnvelope(data []byte, src *keySource) ([]byte, error) {
+	if !isEnvelope(data) {
+		key, err := deriveKey(src.material)
+		if err != nil {
+			return nil, err
+		}
+		return decrypt(data, key)
+	}
+	h, n, err := parseEnvelopeHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	key, id, err := src.derive(h)
+	if err != nil {
+		return nil, err
+	}
+	if len(h.KeyID) > 0 && !bytes.Equal(h.KeyID, id) {
+		if h.KDF == kdfArgon2id {
+			return nil, errors.New("incorrect passphrase for store")
+		}
+		return nil, fmt.Errorf("store was encrypted with key %s but the configured key is %s", hex.EncodeToString(h.KeyID), hex.EncodeToString(id))
+	}
+	return openAEAD(data[n:], key, data[:n])
+}
+
+// headerForWrite returns a header and matching key for a new write. HKDF
+// writes get a fresh salt each time; passphrase writes reuse the salt of the
+// last derivation with current parameters to avoid re-running Argon2id.
+func (s *keySource) headerForWrite() (envelopeHeader, []byte, error) {
+	if s.kdf == kdfAge {
+		s.mu.Lock()
+		cached, key := s.cachedHdr, s.cachedKey
+		s.mu.Unlock()
+		if cached.KDF == kdfAge {
+			return cached, key, nil
+		}
+		return s.newAgeHeader(s.recipients)
+	}
+	h := envelopeHeader{Version: envelopeVersion, KDF: s.kdf}
+	if s.kdf == kdfArgon2id {
+		h.Params = s.argon2.marshal()
+		s.mu.Lock()
+		cached := s.cachedHdr
+		s.mu.Unlock()
+		if cached.KDF == kdfArgon2id && bytes.Equal(cached.Params, h.Params) {
+			h.Salt = cached.Salt
+		}
+	}
+	if h.Salt == nil {
+		h.Salt = make([]byte, envelopeSaltSize)
+		if _, err := io.ReadFull(rand.Reader, h.Salt); err != nil {
+			return h, nil, err
+		}
+	}
+	key, id, err := s.derive(h)
+	if err != nil {
+		return h, nil, err
+	}
+	h.KeyID = id
+	return h, key, nil
+}
+
+// derive returns the file key and key id for the KDF, parameters and salt in h.
+func (s *keySource) derive(h envelopeHeader) ([]byte, []byte, error) {
+	switch h.KDF {
+	case kdfHKDFSHA256:
+		r := hkdf.New(sha256.New, s.material, h.Salt, []byte("envmap-local-encryption-v2"))
+		key := make([]byte, 32)
+		if _, err := io.ReadFull(r, key); err != nil {
+			return nil, nil, err
+		}
+		return key, keyID(s.material), nil
+	case kdfArgon2id:
+		params, err := parseArgon2Params(h.Params)
+		if err != nil {
+			return nil, nil, err
+		}
+		if key := s.cached(h); key != nil {
+			return key, keyID(key), nil
+		}
+		key := argon2.IDKey(s.material, h.Salt, params.Time, params.Memory, params.Threads, 32)
+		s.cache(h, key)
+		// Fingerprint the derived key, never the passphrase itself, so the
+		// key id cannot be used to test passphrase guesses cheaply.
+		return key, keyID(key), nil
+	case kdfAge:
+		if key := s.cached(h); key != nil {
+			return key, keyID(key), nil
+		}
+		params, err := parseAgeParams(h.Params)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, err := s.unwrapAgeDataKey(params)
+		if err != nil {
+			return nil, nil, err
+		}
+		s.cache(h, key)
+		return key, keyID(key), nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported key derivation function %d in store header", h.KDF)
+	}
+}
+
+func envelopeCacheID(h envelopeHeader) []byte {
+	return append(append([]byte{h.KDF}, h.Params...), h.Salt...)
+}
+
+// cached returns the cached key if it was derived for h's KDF, params and salt.
+func (s *keySource) cached(h envelopeHeader) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cachedKey != nil && bytes.Equal(s.cacheID, envelopeCacheID(h)) {
+		return s.cachedKey
+	}
+	return nil
+}
+
+func (s *keySource) cache(h envelopeHeader, key []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cacheID, s.cachedKey = envelopeCacheID(h), key
+	s.cachedHdr = envelopeHeader{Version: envelopeVersion, KDF: h.KDF, Params: h.Params, Salt: h.Salt, KeyID: keyID(key)}
+}
+
+// keyID fingerprints key material so a wrong key is reported as such rather
+// than as a generic authentication failure.
+func keyID(material []byte) []byte {
+	r := hkdf.New(sha256.New, material, nil, []byte("envmap-key-id"))
+	id := make([]byte, keyIDSize)
+	io.ReadFull(r, id)
+	return id
+}
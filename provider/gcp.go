@@ -12,14 +12,19 @@ import (
 
 func init() {
 	Register(Info{
-		Type:           "gcp-secretmanager",
-		Description:    "Google Cloud Secret Manager",
-		Factory:        newGCPSecretManager,
-		RequiredFields: []string{"project"},
-		OptionalFields: []string{"credentials_file"},
+		Type:         "gcp-secretmanager",
+		Description:  "Google Cloud Secret Manager",
+		Factory:      newGCPSecretManager,
+		Fields:       gcpFields,
+		Capabilities: Capabilities{CapRead, CapWrite, CapDelete},
 	})
 }
 
+var gcpFields = []Field{
+	{Name: "project", Type: FieldString, Required: true},
+	{Name: "credentials_file", Type: FieldString, Env: "GOOGLE_APPLICATION_CREDENTIALS"},
+}
+
 type gcpSecretManager struct {
 	svc         *secretmanager.Service
 	projectID   string
@@ -31,12 +36,13 @@ func newGCPSecretManager(envCfg EnvConfig, providerCfg ProviderConfig) (Provider
 	if providerCfg.Extra == nil {
 		providerCfg.Extra = map[string]any{}
 	}
-	project, ok := providerCfg.Extra["project"].(string)
-	if !ok || project == "" {
+	values := newConfigValues(gcpFields, providerCfg)
+	project := values.String("project")
+	if project == "" {
 		return nil, fmt.Errorf("gcp-secretmanager provider requires project in config")
 	}
 	opts := []option.ClientOption{}
-	if credFile, ok := providerCfg.Extra["credentials_file"].(string); ok && credFile != "" {
+	if credFile := values.String("credentials_file"); credFile != "" {
 		opts = append(opts, option.WithCredentialsFile(credFile))
 	}
 	svc, err := secretmanager.NewService(context.Background(), opts...)
@@ -120,3 +126,12 @@ func (p *gcpSecretManager) Set(ctx context.Context, name, value string) error {
 	}
 	return nil
 }
+
+// Delete removes the secret and all of its versions.
+func (p *gcpSecretManager) Delete(ctx context.Context, name string) error {
+	secretName := p.secretName(name)
+	if _, err := p.svc.Projects.Secrets.Delete(secretName).Context(ctx).Do(); err != nil {
+		return fmt.Errorf("gcp secret delete %s: %w", secretName, err)
+	}
+	return nil
+}
@@ -13,6 +13,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"sync"
 	"time"
@@ -23,32 +24,58 @@ import (
 
 func init() {
 	Register(Info{
-		Type:           "local-file",
-		Description:    "Encrypted local file storage",
-		Factory:        newLocalFile,
-		RequiredFields: []string{"path", "encryption"},
-		OptionalFields: []string{},
+		Type:         "local-file",
+		Description:  "Encrypted local file storage",
+		Factory:      newLocalFile,
+		Fields:       localFileFields,
+		Capabilities: Capabilities{CapRead, CapWrite, CapDelete, CapMetadata, CapVersions, CapBatch},
 	})
 
 	Register(Info{
-		Type:           "local-store",
-		Description:    "Encrypted local file storage (alias for local-file)",
-		Factory:        newLocalFile,
-		RequiredFields: []string{"path", "encryption"},
-		OptionalFields: []string{},
+		Type:         "local-store",
+		Description:  "Encrypted local file storage (alias for local-file)",
+		Factory:      newLocalFile,
+		Fields:       localFileFields,
+		Capabilities: Capabilities{CapRead, CapWrite, CapDelete, CapMetadata, CapVersions, CapBatch},
 	})
 }
 
+var localFileFields = []Field{
+	{Name: "path", Type: FieldString, Required: true},
+	{Name: "encryption", Type: FieldObject, Required: true, Fields: encryptionFields},
+	{Name: "history_limit", Type: FieldInt, Default: defaultHistoryLimit},
+}
+
+// defaultHistoryLimit is how many prior values are kept per key when
+// history_limit is not configured.
+const defaultHistoryLimit = 10
+
 type localFile struct {
-	envCfg      EnvConfig
-	providerCfg ProviderConfig
-	key         []byte
-	path        string
-	lock        *flock.Flock
-	mu          sync.Mutex
+	envCfg       EnvConfig
+	providerCfg  ProviderConfig
+	keys         *keySource
+	path         string
+	historyLimit int
+	lock         *flock.Flock
+	mu           sync.Mutex
 }
 
-var _ MetadataLister = (*localFile)(nil)
+// localEntry is the on-disk representation of a secret. The value and
+// created_at fields match SecretRecord so stores written before history
+// was tracked still decode.
+type localEntry struct {
+	Value     string          `json:"value"`
+	CreatedAt time.Time       `json:"created_at,omitempty"`
+	UpdatedAt time.Time       `json:"updated_at,omitempty"`
+	Version   int             `json:"version,omitempty"`
+	History   []SecretVersion `json:"history,omitempty"`
+}
+
+var (
+	_ MetadataLister = (*localFile)(nil)
+	_ Versioner      = (*localFile)(nil)
+	_ Deleter        = (*localFile)(nil)
+)
 
 func newLocalFile(envCfg EnvConfig, providerCfg ProviderConfig) (Provider, error) {
 	if providerCfg.Path == "" {
@@ -57,24 +84,37 @@ func newLocalFile(envCfg EnvConfig, providerCfg ProviderConfig) (Provider, error
 	if providerCfg.Encryption == nil {
 		return nil, fmt.Errorf("local-file provider requires encryption configuration")
 	}
-	keyMaterial, err := loadKeyMaterial(providerCfg.Encryption)
+	keys, err := loadKeySource(providerCfg.Encryption)
 	if err != nil {
 		return nil, err
 	}
-	key, err := deriveKey(keyMaterial)
+	historyLimit, err := parseHistoryLimit(providerCfg.Extra)
 	if err != nil {
-		return nil, fmt.Errorf("derive encryption key: %w", err)
+		return nil, err
 	}
 	lockPath := providerCfg.Path + ".lock"
 	return &localFile{
-		envCfg:      envCfg,
-		providerCfg: providerCfg,
-		key:         key,
-		path:        providerCfg.Path,
-		lock:        flock.New(lockPath),
+		envCfg:       envCfg,
+		providerCfg:  providerCfg,
+		keys:         keys,
+		path:         providerCfg.Path,
+		historyLimit: historyLimit,
+		lock:         flock.New(lockPath),
 	}, nil
 }
 
+func parseHistoryLimit(extra map[string]any) (int, error) {
+	raw, ok := extra["history_limit"]
+	if !ok {
+		return defaultHistoryLimit, nil
+	}
+	limit, ok := raw.(int)
+	if !ok || limit < 0 {
+		return 0, fmt.Errorf("local-file history_limit must be a non-negative integer, got %v", raw)
+	}
+	return limit, nil
+}
+
 func (p *localFile) Get(_ context.Context, name string) (string, error) {
 	var value string
 	err := p.withExclusiveLock(func() error {
@@ -110,18 +150,128 @@ func (p *localFile) Set(_ context.Context, name, value string) error {
 		if err != nil {
 			return err
 		}
-		entry := entries[name]
-		if entry.CreatedAt.IsZero() {
-			entry.CreatedAt = time.Now().UTC()
+		entries[name] = p.updateEntry(entries[name], value)
+		return p.writeAllUnlocked(entries)
+	})
+}
+
+// Delete removes a secret along with its retained history.
+func (p *localFile) Delete(_ context.Context, name string) error {
+	return p.withExclusiveLock(func() error {
+		entries, err := p.readAllUnlocked()
+		if err != nil {
+			return err
 		}
-		entry.Value = value
-		entries[name] = entry
+		if _, ok := entries[name]; !ok {
+			return fmt.Errorf("missing secret %s for env (expected from %s)", name, p.path)
+		}
+		delete(entries, name)
 		return p.writeAllUnlocked(entries)
 	})
 }
 
-func (p *localFile) readAllUnlocked() (map[string]SecretRecord, error) {
-	entries := map[string]SecretRecord{}
+// History returns the current value followed by retained prior values, newest first.
+func (p *localFile) History(_ context.Context, name string) ([]SecretVersion, error) {
+	var versions []SecretVersion
+	err := p.withExclusiveLock(func() error {
+		entries, err := p.readAllUnlocked()
+		if err != nil {
+			return err
+		}
+		entry, ok := entries[name]
+		if !ok {
+			return fmt.Errorf("missing secret %s for env (expected from %s)", name, p.path)
+		}
+		versions = append(versions, SecretVersion{
+			Version:   entry.currentVersion(),
+			Value:     entry.Value,
+			CreatedAt: entry.updatedAt(),
+			Current:   true,
+		})
+		for i := len(entry.History) - 1; i >= 0; i-- {
+			versions = append(versions, entry.History[i])
+		}
+		return nil
+	})
+	return versions, err
+}
+
+// Rollback restores a retained version by writing its value as a new version,
+// so the rollback itself can be undone.
+func (p *localFile) Rollback(_ context.Context, name string, version int) error {
+	return p.withExclusiveLock(func() error {
+		entries, err := p.readAllUnlocked()
+		if err != nil {
+			return err
+		}
+		entry, ok := entries[name]
+		if !ok {
+			return fmt.Errorf("missing secret %s for env (expected from %s)", name, p.path)
+		}
+		if version == entry.currentVersion() {
+			return fmt.Errorf("version %d of %s is already current", version, name)
+		}
+		for _, v := range entry.History {
+			if v.Version == version {
+				if v.Value == entry.Value {
+					return fmt.Errorf("version %d of %s has the same value as the current version %d", version, name, entry.currentVersion())
+				}
+				entries[name] = p.updateEntry(entry, v.Value)
+				return p.writeAllUnlocked(entries)
+			}
+		}
+		return fmt.Errorf("version %d of %s not found in history", version, name)
+	})
+}
+
+// updateEntry sets a new value, moving the previous one into bounded history.
+func (p *localFile) updateEntry(entry localEntry, value string) localEntry {
+	now := time.Now().UTC()
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = now
+		entry.UpdatedAt = now
+		entry.Version = 1
+		entry.Value = value
+		return entry
+	}
+	if entry.Value == value {
+		return entry
+	}
+	if p.historyLimit > 0 {
+		entry.History = append(entry.History, SecretVersion{
+			Version:   entry.currentVersion(),
+			Value:     entry.Value,
+			CreatedAt: entry.updatedAt(),
+		})
+		if extra := len(entry.History) - p.historyLimit; extra > 0 {
+			entry.History = entry.History[extra:]
+		}
+	} else {
+		entry.History = nil
+	}
+	entry.Version = entry.currentVersion() + 1
+	entry.UpdatedAt = now
+	entry.Value = value
+	return entry
+}
+
+// currentVersion treats entries written before versioning as version 1.
+func (e localEntry) currentVersion() int {
+	if e.Version == 0 {
+		return 1
+	}
+	return e.Version
+}
+
+func (e localEntry) updatedAt() time.Time {
+	if e.UpdatedAt.IsZero() {
+		return e.CreatedAt
+	}
+	return e.UpdatedAt
+}
+
+func (p *localFile) readAllUnlocked() (map[string]localEntry, error) {
+	entries := map[string]localEntry{}
 	raw, err := os.ReadFile(p.path)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
@@ -132,7 +282,7 @@ func (p *localFile) readAllUnlocked() (map[string]SecretRecord, error) {
 	if len(raw) == 0 {
 		return entries, nil
 	}
-	plaintext, err := decrypt(raw, p.key)
+	plaintext, err := openEnvelope(raw, p.keys)
 	if err != nil {
 		return nil, fmt.Errorf("decrypt local store: %w", err)
 	}
@@ -142,18 +292,21 @@ func (p *localFile) readAllUnlocked() (map[string]SecretRecord, error) {
 	return entries, nil
 }
 
-func (p *localFile) writeAllUnlocked(entries map[string]SecretRecord) error {
+func (p *localFile) writeAllUnlocked(entries map[string]localEntry) error {
 	encoded, err := json.MarshalIndent(entries, "", "  ")
 	if err != nil {
 		return fmt.Errorf("encode local store: %w", err)
 	}
-	ciphertext, err := encrypt(encoded, p.key)
+	ciphertext, err := sealEnvelope(encoded, p.keys)
 	if err != nil {
 		return fmt.Errorf("encrypt local store: %w", err)
 	}
+	return writeFileAtomic(p.path, ciphertext)
+}
 
-	// Atomic write: write to temp file, then rename
-	dir := filepath.Dir(p.path)
+// writeFileAtomic writes data to a temp file in the same directory, then renames it over path.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0o700); err != nil {
 		return fmt.Errorf("create local store dir: %w", err)
 	}
@@ -176,7 +329,7 @@ func (p *localFile) writeAllUnlocked(entries map[string]SecretRecord) error {
 		tmp.Close()
 		return fmt.Errorf("chmod temp file: %w", err)
 	}
-	if _, err := tmp.Write(ciphertext); err != nil {
+	if _, err := tmp.Write(data); err != nil {
 		tmp.Close()
 		return fmt.Errorf("write temp file: %w", err)
 	}
@@ -189,7 +342,7 @@ func (p *localFile) writeAllUnlocked(entries map[string]SecretRecord) error {
 	}
 
 	// Atomic rename
-	if err := os.Rename(tmpPath, p.path); err != nil {
+	if err := os.Rename(tmpPath, path); err != nil {
 		return fmt.Errorf("rename temp file: %w", err)
 	}
 
@@ -209,7 +362,7 @@ func (p *localFile) ListWithMetadata(_ context.Context, prefix string) (map[stri
 				continue
 			}
 			base := TrimPrefix(p.envCfg, name)
-			out[base] = val
+			out[base] = SecretRecord{Value: val.Value, CreatedAt: val.CreatedAt}
 		}
 		return nil
 	})
@@ -238,7 +391,7 @@ func (p *localFile) withExclusiveLock(fn func() error) error {
 // --- Key Management ---
 
 // deriveKey uses HKDF to derive a 256-bit encryption key from arbitrary key material.
-// HKDF is appropriate for both high-entropy (random file) and lower-entropy (passphrase) inputs.
+// It is the key schedule for legacy headerless stores; new files use keySource.derive.
 func deriveKey(material []byte) ([]byte, error) {
 	// HKDF with SHA-256, no salt (we use random nonces per encryption),
 	// and a fixed info string to bind the key to this purpose.
@@ -251,6 +404,59 @@ func deriveKey(material []byte) ([]byte, error) {
 	return key, nil
 }
 
+// loadKeySource resolves the configured key or passphrase into a keySource.
+func loadKeySource(cfg *EncryptionConfig) (*keySource, error) {
+	if cfg.Type == EncryptionTypeAge {
+		return newAgeKeySource(cfg)
+	}
+	if cfg.IsPassphrase() {
+		passphrase, err := loadPassphrase(cfg)
+		if err != nil {
+			return nil, err
+		}
+		params := defaultArgon2Params
+		if cfg.KDFTime != 0 {
+			params.Time = cfg.KDFTime
+		}
+		if cfg.KDFMemory != 0 {
+			params.Memory = cfg.KDFMemory
+		}
+		if cfg.KDFThreads != 0 {
+			params.Threads = cfg.KDFThreads
+		}
+		if err := params.checkLimits(); err != nil {
+			return nil, fmt.Errorf("encryption: %w", err)
+		}
+		return newPassphraseKeySource(passphrase, params), nil
+	}
+	material, err := loadKeyMaterial(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newKeySource(material), nil
+}
+
+// minPassphraseLength is a floor, not a strength check; Argon2id slows
+// guessing but cannot rescue a trivially short passphrase.
+const minPassphraseLength = 8
+
+func loadPassphrase(cfg *EncryptionConfig) ([]byte, error) {
+	passphrase := cfg.Passphrase
+	if passphrase == "" && cfg.KeyEnv != "" {
+		passphrase = os.Getenv(cfg.KeyEnv)
+	}
+	if passphrase == "" {
+		if cfg.KeyEnv != "" {
+			return nil, fmt.Errorf("passphrase not provided; set %s or run interactively to be prompted", cfg.KeyEnv)
+		}
+		return nil, errors.New("passphrase not provided; set encryption.key_env or run interactively to be prompted")
+	}
+	if len(passphrase) < minPassphraseLength {
+		return nil, fmt.Errorf("passphrase is too short; use at least %d characters", minPassphraseLength)
+	}
+	return []byte(passphrase), nil
+}
+
 func loadKeyMaterial(cfg *EncryptionConfig) ([]byte, error) {
 	if cfg.KeyEnv != "" {
 		if v := os.Getenv(cfg.KeyEnv); v != "" {
@@ -282,6 +488,15 @@ func loadKeyMaterial(cfg *EncryptionConfig) ([]byte, error) {
 // --- Encryption ---
 
 func encrypt(plaintext, key []byte) ([]byte, error) {
+	return sealAEAD(plaintext, key, nil)
+}
+
+func decrypt(ciphertext, key []byte) ([]byte, error) {
+	return openAEAD(ciphertext, key, nil)
+}
+
+// sealAEAD encrypts with AES-256-GCM under a random nonce, returning nonce||ciphertext.
+func sealAEAD(plaintext, key, additionalData []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
@@ -294,11 +509,11 @@ func encrypt(plaintext, key []byte) ([]byte, error) {
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return nil, err
 	}
-	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
+	ciphertext := gcm.Seal(nonce, nonce, plaintext, additionalData)
 	return ciphertext, nil
 }
 
-func decrypt(ciphertext, key []byte) ([]byte, error) {
+func openAEAD(ciphertext, key, additionalData []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
@@ -313,7 +528,48 @@ func decrypt(ciphertext, key []byte) ([]byte, error) {
 	}
 	nonce := ciphertext[:size]
 	data := ciphertext[size:]
-	return gcm.Open(nil, nonce, data, nil)
+	return gcm.Open(nil, nonce, data, additionalData)
+}
+
+// RotateKey re-encrypts the local store at path from oldCfg's key to newCfg's key.
+// The store is rewritten atomically and read back under the new key; if that
+// verification fails, the original ciphertext is restored.
+func RotateKey(path string, oldCfg, newCfg *EncryptionConfig) error {
+	oldProvider, err := newLocalFile(EnvConfig{}, ProviderConfig{Path: path, Encryption: oldCfg})
+	if err != nil {
+		return fmt.Errorf("open store with current key: %w", err)
+	}
+	newProvider, err := newLocalFile(EnvConfig{}, ProviderConfig{Path: path, Encryption: newCfg})
+	if err != nil {
+		return fmt.Errorf("load new key: %w", err)
+	}
+	oldStore := oldProvider.(*localFile)
+	newStore := newProvider.(*localFile)
+
+	return oldStore.withExclusiveLock(func() error {
+		original, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read local store: %w", err)
+		}
+		entries, err := oldStore.readAllUnlocked()
+		if err != nil {
+			return err
+		}
+		if err := newStore.writeAllUnlocked(entries); err != nil {
+			return err
+		}
+		reread, err := newStore.readAllUnlocked()
+		if err == nil && !reflect.DeepEqual(entries, reread) {
+			err = errors.New("re-encrypted store does not match original contents")
+		}
+		if err != nil {
+			if restoreErr := writeFileAtomic(path, original); restoreErr != nil {
+				return fmt.Errorf("verify rotated store: %w (restore also failed: %v)", err, restoreErr)
+			}
+			return fmt.Errorf("verify rotated store: %w", err)
+		}
+		return nil
+	})
 }
 
 // GenerateKeyFile creates a new cryptographically secure key file.
@@ -4,8 +4,11 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"filippo.io/age"
 )
 
 func TestLocalFileStoresCreatedAt(t *testing.T) {
@@ -67,6 +70,182 @@ func TestLocalFileStoresCreatedAt(t *testing.T) {
 	}
 }
 
+func TestLocalFileHistoryAndRollback(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "key")
+	if err := os.WriteFile(keyPath, bytesOfLen(32), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	cfg := ProviderConfig{
+		Path:       filepath.Join(dir, "secrets.db"),
+		Encryption: &EncryptionConfig{KeyFile: keyPath},
+		Extra:      map[string]any{"history_limit": 2},
+	}
+
+	p, err := newLocalFile(EnvConfig{}, cfg)
+	if err != nil {
+		t.Fatalf("newLocalFile: %v", err)
+	}
+	lf := p.(*localFile)
+
+	ctx := context.Background()
+	for _, v := range []string{"one", "two", "two", "three", "four"} {
+		if err := lf.Set(ctx, "TOKEN", v); err != nil {
+			t.Fatalf("Set %s: %v", v, err)
+		}
+	}
+
+	versions, err := lf.History(ctx, "TOKEN")
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	// Unchanged writes do not create versions; limit 2 drops "one".
+	want := []SecretVersion{
+		{Version: 4, Value: "four", Current: true},
+		{Version: 3, Value: "three"},
+		{Version: 2, Value: "two"},
+	}
+	if len(versions) != len(want) {
+		t.Fatalf("got %d versions, want %d: %+v", len(versions), len(want), versions)
+	}
+	for i, w := range want {
+		got := versions[i]
+		if got.Version != w.Version || got.Value != w.Value || got.Current != w.Current {
+			t.Errorf("versions[%d] = %+v, want %+v", i, got, w)
+		}
+		if got.CreatedAt.IsZero() {
+			t.Errorf("versions[%d] missing timestamp", i)
+		}
+	}
+
+	if err := lf.Rollback(ctx, "TOKEN", 2); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	val, err := lf.Get(ctx, "TOKEN")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if val != "two" {
+		t.Errorf("after rollback got %q, want %q", val, "two")
+	}
+	versions, err = lf.History(ctx, "TOKEN")
+	if err != nil {
+		t.Fatalf("History after rollback: %v", err)
+	}
+	if versions[0].Version != 5 || versions[1].Value != "four" {
+		t.Errorf("rollback should append a new version, got %+v", versions)
+	}
+
+	if err := lf.Rollback(ctx, "TOKEN", 1); err == nil {
+		t.Error("expected error rolling back to a pruned version")
+	}
+
+	// Version 4 holds "four" again once it is set back, so there is nothing to restore.
+	if err := lf.Set(ctx, "TOKEN", "four"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lf.Rollback(ctx, "TOKEN", 4); err == nil || !strings.Contains(err.Error(), "same value") {
+		t.Errorf("rollback to a version equal to current: %v, want same value error", err)
+	}
+}
+
+func TestLocalFileDelete(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "key")
+	if err := os.WriteFile(keyPath, bytesOfLen(32), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	p, err := newLocalFile(EnvConfig{}, ProviderConfig{
+		Path:       filepath.Join(dir, "secrets.db"),
+		Encryption: &EncryptionConfig{KeyFile: keyPath},
+	})
+	if err != nil {
+		t.Fatalf("newLocalFile: %v", err)
+	}
+	lf := p.(*localFile)
+
+	ctx := context.Background()
+	if err := lf.Set(ctx, "KEEP", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lf.Set(ctx, "DROP", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lf.Delete(ctx, "DROP"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	values, err := lf.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := values["DROP"]; ok || values["KEEP"] != "a" {
+		t.Errorf("unexpected values after delete: %v", values)
+	}
+	if err := lf.Delete(ctx, "DROP"); err == nil {
+		t.Error("deleting a missing key should fail")
+	}
+}
+
+func TestLocalFileAgeRecipients(t *testing.T) {
+	dir := t.TempDir()
+	alice, _ := age.GenerateX25519Identity()
+	bob, _ := age.GenerateX25519Identity()
+	identityFile := func(id *age.X25519Identity) string {
+		path := filepath.Join(dir, strings.ToLower(id.Recipient().String()[:12]))
+		if err := os.WriteFile(path, []byte(id.String()+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	storePath := filepath.Join(dir, "team.db")
+	aliceEnc := &EncryptionConfig{Type: EncryptionTypeAge, IdentityFile: identityFile(alice), Recipients: []string{alice.Recipient().String()}}
+	bobEnc := &EncryptionConfig{Type: EncryptionTypeAge, IdentityFile: identityFile(bob)}
+	open := func(enc *EncryptionConfig) Provider {
+		p, err := newLocalFile(EnvConfig{}, ProviderConfig{Path: storePath, Encryption: enc})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	ctx := context.Background()
+	if err := open(aliceEnc).Set(ctx, "API_KEY", "shared"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if _, err := open(bobEnc).Get(ctx, "API_KEY"); err == nil {
+		t.Fatal("bob should not read the store before being added")
+	}
+
+	recipients, err := AddRecipients(storePath, aliceEnc, []string{bob.Recipient().String()})
+	if err != nil {
+		t.Fatalf("AddRecipients: %v", err)
+	}
+	if len(recipients) != 2 {
+		t.Errorf("recipients after add = %v", recipients)
+	}
+	if v, err := open(bobEnc).Get(ctx, "API_KEY"); err != nil || v != "shared" {
+		t.Fatalf("bob Get after add = %q, %v", v, err)
+	}
+
+	if _, err := RemoveRecipients(storePath, bobEnc, []string{alice.Recipient().String()}); err != nil {
+		t.Fatalf("RemoveRecipients: %v", err)
+	}
+	if _, err := open(aliceEnc).Get(ctx, "API_KEY"); err == nil {
+		t.Error("alice should lose access after removal")
+	}
+	got, err := StoreRecipients(storePath, bobEnc)
+	if err != nil || len(got) != 1 || got[0] != bob.Recipient().String() {
+		t.Errorf("StoreRecipients = %v, %v", got, err)
+	}
+	if _, err := RemoveRecipients(storePath, bobEnc, got); err == nil {
+		t.Error("removing every recipient should be refused")
+	}
+}
+
 func bytesOfLen(n int) []byte {
 	buf := make([]byte, n)
 	for i := range buf {
@@ -9,6 +9,17 @@ import (
 type SecretRecord struct {
 	Value     string    `json:"value"`
 	CreatedAt time.Time `json:"created_at,omitempty"`
+	// Source names the env layer the value came from when an env merges
+	// several providers.
+	Source string `json:"source,omitempty"`
+}
+
+// SecretVersion describes one stored revision of a secret.
+type SecretVersion struct {
+	Version   int       `json:"version"`
+	Value     string    `json:"value"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+	Current   bool      `json:"current,omitempty"`
 }
 
 // MetadataLister can return values plus metadata in one call.
@@ -16,6 +27,14 @@ type MetadataLister interface {
 	ListWithMetadata(ctx context.Context, prefix string) (map[string]SecretRecord, error)
 }
 
+// Versioner is implemented by providers that retain prior values of a secret.
+// History returns versions newest first; Rollback makes the given version
+// current again by writing its value as a new version.
+type Versioner interface {
+	History(ctx context.Context, name string) ([]SecretVersion, error)
+	Rollback(ctx context.Context, name string, version int) error
+}
+
 // ListOrDescribe fetches secrets with metadata when the provider supports it.
 // For providers that do not expose metadata, the map still contains values,
 // but CreatedAt is left zero to signal "unknown".
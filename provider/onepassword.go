@@ -3,7 +3,6 @@ package provider
 import (
 	"context"
 	"fmt"
-	"os"
 	"strings"
 
 	opconnect "github.com/1Password/connect-sdk-go/connect"
@@ -12,14 +11,21 @@ import (
 
 func init() {
 	Register(Info{
-		Type:           "onepassword",
-		Description:    "1Password Connect server",
-		Factory:        newOnePassword,
-		RequiredFields: []string{"connect_host"},
-		OptionalFields: []string{"connect_token", "vault_id", "vault"},
+		Type:         "onepassword",
+		Description:  "1Password Connect server",
+		Factory:      newOnePassword,
+		Fields:       onePasswordFields,
+		Capabilities: Capabilities{CapRead, CapWrite, CapDelete},
 	})
 }
 
+var onePasswordFields = []Field{
+	{Name: "connect_host", Type: FieldString, Required: true, Env: "OP_CONNECT_HOST"},
+	{Name: "connect_token", Type: FieldString, Required: true, Env: "OP_CONNECT_TOKEN", Secret: true},
+	{Name: "vault_id", Type: FieldString},
+	{Name: "vault", Type: FieldString},
+}
+
 type onePassword struct {
 	client      opconnect.Client
 	vaultID     string
@@ -31,22 +37,20 @@ func newOnePassword(envCfg EnvConfig, providerCfg ProviderConfig) (Provider, err
 	if providerCfg.Extra == nil {
 		providerCfg.Extra = map[string]any{}
 	}
-	rawHost, ok := providerCfg.Extra["connect_host"].(string)
-	if !ok || rawHost == "" {
-		return nil, fmt.Errorf("onepassword provider requires connect_host")
-	}
-	token := os.Getenv("OP_CONNECT_TOKEN")
-	if t, ok := providerCfg.Extra["connect_token"].(string); ok && t != "" {
-		token = t
+	values := newConfigValues(onePasswordFields, providerCfg)
+	rawHost := values.String("connect_host")
+	if rawHost == "" {
+		return nil, fmt.Errorf("onepassword provider requires connect_host in config or OP_CONNECT_HOST")
 	}
+	token := values.String("connect_token")
 	if token == "" {
 		return nil, fmt.Errorf("onepassword provider requires OP_CONNECT_TOKEN env or connect_token in config")
 	}
 	client := opconnect.NewClient(rawHost, token)
 	var vaultID string
-	if v, ok := providerCfg.Extra["vault_id"].(string); ok && v != "" {
+	if v := values.String("vault_id"); v != "" {
 		vaultID = v
-	} else if v, ok := providerCfg.Extra["vault"].(string); ok && v != "" {
+	} else if v := values.String("vault"); v != "" {
 		vault, err := client.GetVaultByTitle(v)
 		if err != nil {
 			return nil, fmt.Errorf("resolve 1password vault %s: %w", v, err)
@@ -133,3 +137,15 @@ func (p *onePassword) Set(ctx context.Context, name, value string) error {
 	}
 	return nil
 }
+
+func (p *onePassword) Delete(ctx context.Context, name string) error {
+	itemName := ApplyPrefix(p.envCfg, name)
+	item, err := p.client.GetItemByTitle(itemName, p.vaultID)
+	if err != nil {
+		return fmt.Errorf("1password get %s: %w", itemName, err)
+	}
+	if err := p.client.DeleteItem(item, p.vaultID); err != nil {
+		return fmt.Errorf("1password delete %s: %w", itemName, err)
+	}
+	return nil
+}
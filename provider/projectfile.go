@@ -0,0 +1,327 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/flock"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	Register(Info{
+		Type:        "project-file",
+		Description: "Per-value encrypted secrets file, safe to commit next to .envmap.yaml",
+		Factory:     newProjectFile,
+		Fields: []Field{
+			{Name: "encryption", Type: FieldObject, Required: true, Fields: encryptionFields},
+			{Name: "path", Type: FieldString, Default: DefaultProjectFilePath},
+		},
+		Capabilities: Capabilities{CapRead, CapWrite, CapDelete, CapMetadata, CapBatch},
+	})
+}
+
+// DefaultProjectFilePath is used when a project-file provider has no path.
+const DefaultProjectFilePath = ".envmap.secrets.yaml"
+
+const projectFileHeaderComment = "Managed by envmap. Keys and timestamps are plaintext; values are encrypted.\nEdit with: envmap set --env ENV KEY --prompt"
+
+// projectFileDoc is the YAML layout of a project secrets file. The envelope
+// header is stored once so every value shares a file key, and it is kept
+// stable across writes so diffs only show the keys that changed.
+type projectFileDoc struct {
+	Secrets map[string]projectFileSecret `yaml:"secrets"`
+	Envmap  projectFileMeta              `yaml:"envmap"`
+}
+
+type projectFileSecret struct {
+	Value     string    `yaml:"value"`
+	CreatedAt time.Time `yaml:"created_at,omitempty"`
+	UpdatedAt time.Time `yaml:"updated_at,omitempty"`
+}
+
+type projectFileMeta struct {
+	Version int    `yaml:"version"`
+	Header  string `yaml:"header"`
+}
+
+const projectFileVersion = 1
+
+type projectFile struct {
+	envCfg EnvConfig
+	path   string
+	keys   *keySource
+	lock   *flock.Flock
+	mu     sync.Mutex
+}
+
+var (
+	_ MetadataLister = (*projectFile)(nil)
+	_ Deleter        = (*projectFile)(nil)
+)
+
+func newProjectFile(envCfg EnvConfig, providerCfg ProviderConfig) (Provider, error) {
+	if providerCfg.Encryption == nil {
+		return nil, fmt.Errorf("project-file provider requires encryption configuration")
+	}
+	path := providerCfg.Path
+	if path == "" {
+		path = DefaultProjectFilePath
+	}
+	keys, err := loadKeySource(providerCfg.Encryption)
+	if err != nil {
+		return nil, err
+	}
+	lockPath, err := projectFileLockPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return &projectFile{
+		envCfg: envCfg,
+		path:   path,
+		keys:   keys,
+		lock:   flock.New(lockPath),
+	}, nil
+}
+
+func (p *projectFile) Get(_ context.Context, name string) (string, error) {
+	var value string
+	err := p.withLock(func() error {
+		doc, key, header, err := p.load()
+		if err != nil {
+			return err
+		}
+		secret, ok := doc.Secrets[name]
+		if !ok {
+			return fmt.Errorf("missing secret %s in %s", name, p.path)
+		}
+		value, err = p.decryptValue(name, secret.Value, key, header)
+		return err
+	})
+	return value, err
+}
+
+func (p *projectFile) List(ctx context.Context, prefix string) (map[string]string, error) {
+	records, err := p.ListWithMetadata(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]string, len(records))
+	for k, rec := range records {
+		out[k] = rec.Value
+	}
+	return out, nil
+}
+
+func (p *projectFile) ListWithMetadata(_ context.Context, prefix string) (map[string]SecretRecord, error) {
+	out := make(map[string]SecretRecord)
+	err := p.withLock(func() error {
+		doc, key, header, err := p.load()
+		if err != nil {
+			return err
+		}
+		for name, secret := range doc.Secrets {
+			if prefix != "" && !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			value, err := p.decryptValue(name, secret.Value, key, header)
+			if err != nil {
+				return err
+			}
+			out[TrimPrefix(p.envCfg, name)] = SecretRecord{Value: value, CreatedAt: secret.CreatedAt}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (p *projectFile) Set(_ context.Context, name, value string) error {
+	return p.withLock(func() error {
+		doc, key, header, err := p.load()
+		if err != nil {
+			return err
+		}
+		secret := doc.Secrets[name]
+		if secret.Value != "" {
+			current, err := p.decryptValue(name, secret.Value, key, header)
+			if err != nil {
+				return err
+			}
+			if current == value {
+				return nil
+			}
+		}
+		encrypted, err := p.encryptValue(name, value, key, header)
+		if err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		if secret.CreatedAt.IsZero() {
+			secret.CreatedAt = now
+		}
+		secret.UpdatedAt = now
+		secret.Value = encrypted
+		doc.Secrets[name] = secret
+		return p.save(doc)
+	})
+}
+
+func (p *projectFile) Delete(_ context.Context, name string) error {
+	return p.withLock(func() error {
+		doc, _, _, err := p.load()
+		if err != nil {
+			return err
+		}
+		if _, ok := doc.Secrets[name]; !ok {
+			return fmt.Errorf("missing secret %s in %s", name, p.path)
+		}
+		delete(doc.Secrets, name)
+		return p.save(doc)
+	})
+}
+
+// load reads the file and returns it with the file key and raw header. A
+// missing file yields an empty document with a newly generated header.
+func (p *projectFile) load() (projectFileDoc, []byte, []byte, error) {
+	doc := projectFileDoc{Secrets: map[string]projectFileSecret{}}
+	raw, err := os.ReadFile(p.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return doc, nil, nil, fmt.Errorf("read %s: %w", p.path, err)
+	}
+	if len(bytes.TrimSpace(raw)) == 0 {
+		h, key, err := p.keys.headerForWrite()
+		if err != nil {
+			return doc, nil, nil, err
+		}
+		header := h.marshal()
+		doc.Envmap = projectFileMeta{Version: projectFileVersion, Header: base64.StdEncoding.EncodeToString(header)}
+		return doc, key, header, nil
+	}
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return doc, nil, nil, fmt.Errorf("parse %s: %w", p.path, err)
+	}
+	if doc.Envmap.Version > projectFileVersion {
+		return doc, nil, nil, fmt.Errorf("%s uses format version %d; upgrade envmap", p.path, doc.Envmap.Version)
+	}
+	if doc.Secrets == nil {
+		doc.Secrets = map[string]projectFileSecret{}
+	}
+	header, err := base64.StdEncoding.DecodeString(doc.Envmap.Header)
+	if err != nil || !isEnvelope(header) {
+		return doc, nil, nil, fmt.Errorf("%s has a missing or invalid envmap.header", p.path)
+	}
+	h, _, err := parseEnvelopeHeader(header)
+	if err != nil {
+		return doc, nil, nil, err
+	}
+	key, id, err := p.keys.derive(h)
+	if err != nil {
+		return doc, nil, nil, err
+	}
+	if !bytes.Equal(h.KeyID, id) {
+		return doc, nil, nil, fmt.Errorf("%s was encrypted with a different key than the one configured", p.path)
+	}
+	return doc, key, header, nil
+}
+
+func (p *projectFile) save(doc projectFileDoc) error {
+	var node yaml.Node
+	if err := node.Encode(doc); err != nil {
+		return fmt.Errorf("encode %s: %w", p.path, err)
+	}
+	node.HeadComment = projectFileHeaderComment
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return fmt.Errorf("encode %s: %w", p.path, err)
+	}
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("encode %s: %w", p.path, err)
+	}
+	return writeFileAtomic(p.path, buf.Bytes())
+}
+
+// Values are sealed with the header and secret name as associated data, so
+// a ciphertext cannot be moved to another key or another file unnoticed.
+func valueAAD(header []byte, name string) []byte {
+	return append(append(append([]byte(nil), header...), 0), name...)
+}
+
+func (p *projectFile) encryptValue(name, value string, key, header []byte) (string, error) {
+	sealed, err := sealAEAD([]byte(value), key, valueAAD(header, name))
+	if err != nil {
+		return "", fmt.Errorf("encrypt %s: %w", name, err)
+	}
+	return "ENC[" + base64.StdEncoding.EncodeToString(sealed) + "]", nil
+}
+
+func (p *projectFile) decryptValue(name, value string, key, header []byte) (string, error) {
+	if !strings.HasPrefix(value, "ENC[") || !strings.HasSuffix(value, "]") {
+		return "", fmt.Errorf("value for %s in %s is not encrypted; set it with envmap set", name, p.path)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(value[len("ENC[") : len(value)-1])
+	if err != nil {
+		return "", fmt.Errorf("decode %s: %w", name, err)
+	}
+	plaintext, err := openAEAD(sealed, key, valueAAD(header, name))
+	if err != nil {
+		return "", fmt.Errorf("decrypt %s: %w", name, err)
+	}
+	return string(plaintext), nil
+}
+
+// projectFileLockPath keeps the lock outside the repository so it never
+// shows up as an untracked file next to the committed secrets. Locks live in
+// the user's own cache directory, created 0700, so other local users cannot
+// pre-create or hold them; without a cache directory the lock sits next to
+// the project file.
+func projectFileLockPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return abs + ".lock", nil
+	}
+	dir := filepath.Join(cache, "envmap", "locks")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("create lock directory: %w", err)
+	}
+	if err := os.Chmod(dir, 0o700); err != nil {
+		return "", fmt.Errorf("secure lock directory: %w", err)
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(dir, "project-"+hex.EncodeToString(sum[:8])+".lock"), nil
+}
+
+func (p *projectFile) withLock(fn func() error) error {
+	if err := p.lock.Lock(); err != nil {
+		return fmt.Errorf("acquire lock %s: %w", p.lock.Path(), err)
+	}
+	defer func() {
+		if err := p.lock.Unlock(); err != nil {
+			log.Printf("envmap: unlock %s: %v", p.lock.Path(), err)
+		}
+	}()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return fn()
+}
@@ -0,0 +1,151 @@
+package provider
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestProjectFileRoundtrip(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "key")
+	if err := GenerateKeyFile(keyPath); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, DefaultProjectFilePath)
+	envCfg := EnvConfig{Prefix: "dev/"}
+	cfg := ProviderConfig{Path: path, Encryption: &EncryptionConfig{KeyFile: keyPath}}
+
+	p, err := newProjectFile(envCfg, cfg)
+	if err != nil {
+		t.Fatalf("newProjectFile: %v", err)
+	}
+	ctx := context.Background()
+	for k, v := range map[string]string{"DB_PASSWORD": "hunter2", "API_KEY": "sk_live_123"} {
+		if err := p.Set(ctx, ApplyPrefix(envCfg, k), v); err != nil {
+			t.Fatalf("Set %s: %v", k, err)
+		}
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(raw)
+	if !strings.Contains(content, "dev/DB_PASSWORD:") {
+		t.Errorf("key names should be plaintext:\n%s", content)
+	}
+	if strings.Contains(content, "hunter2") || strings.Contains(content, "sk_live_123") {
+		t.Errorf("values must not appear in plaintext:\n%s", content)
+	}
+
+	// Rewriting one key leaves the other's ciphertext untouched.
+	before := extractValueLine(t, content, "dev/API_KEY")
+	if err := p.Set(ctx, "dev/DB_PASSWORD", "changed"); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ = os.ReadFile(path)
+	if after := extractValueLine(t, string(raw), "dev/API_KEY"); after != before {
+		t.Errorf("unchanged value was re-encrypted: %q -> %q", before, after)
+	}
+
+	reopened, err := newProjectFile(envCfg, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := reopened.(MetadataLister).ListWithMetadata(ctx, ResolvedPrefix(envCfg))
+	if err != nil {
+		t.Fatalf("ListWithMetadata: %v", err)
+	}
+	if records["DB_PASSWORD"].Value != "changed" || records["API_KEY"].Value != "sk_live_123" {
+		t.Errorf("unexpected records %+v", records)
+	}
+	if records["API_KEY"].CreatedAt.IsZero() {
+		t.Error("expected CreatedAt metadata")
+	}
+
+	if err := reopened.(*projectFile).Delete(ctx, "dev/API_KEY"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := reopened.Get(ctx, "dev/API_KEY"); err == nil {
+		t.Error("expected deleted key to be missing")
+	}
+}
+
+func TestProjectFileRejectsMovedCiphertext(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "key")
+	if err := GenerateKeyFile(keyPath); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, DefaultProjectFilePath)
+	p, err := newProjectFile(EnvConfig{}, ProviderConfig{Path: path, Encryption: &EncryptionConfig{KeyFile: keyPath}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := p.Set(ctx, "A", "alpha"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Set(ctx, "B", "bravo"); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := os.ReadFile(path)
+	content := string(raw)
+	a := extractValueLine(t, content, "A")
+	b := extractValueLine(t, content, "B")
+	swapped := strings.Replace(content, b, a, 1)
+	if err := os.WriteFile(path, []byte(swapped), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Get(ctx, "B"); err == nil {
+		t.Error("a value copied from another key should fail to decrypt")
+	}
+}
+
+// extractValueLine returns the "value:" line following the given key.
+func extractValueLine(t *testing.T, content, key string) string {
+	t.Helper()
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) == key+":" {
+			for _, next := range lines[i+1:] {
+				if strings.Contains(next, "value:") {
+					return next
+				}
+			}
+		}
+	}
+	t.Fatalf("key %s not found in:\n%s", key, content)
+	return ""
+}
+
+func TestProjectFileLockPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(home, "cache"))
+	t.Setenv("LocalAppData", filepath.Join(home, "cache"))
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		t.Skipf("no user cache directory: %v", err)
+	}
+
+	got, err := projectFileLockPath(filepath.Join(home, "repo", DefaultProjectFilePath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(cache, "envmap", "locks")
+	if filepath.Dir(got) != dir {
+		t.Errorf("lock path = %s, want it in %s", got, dir)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0o700 {
+		t.Errorf("lock directory mode = %v, want 0700", info.Mode().Perm())
+	}
+}
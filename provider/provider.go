@@ -28,6 +28,18 @@ type Provider interface {
 	Set(ctx context.Context, name, value string) error
 }
 
+// Deleter is implemented by providers that can remove a secret.
+type Deleter interface {
+	// Delete removes the named secret. Deleting a missing secret is an error.
+	Delete(ctx context.Context, name string) error
+}
+
+// FieldGetter is implemented by providers whose secrets hold several named
+// fields; Get returns the provider's default field.
+type FieldGetter interface {
+	GetField(ctx context.Context, name, field string) (string, error)
+}
+
 // Factory creates a Provider from configuration.
 type Factory func(envCfg EnvConfig, providerCfg ProviderConfig) (Provider, error)
 
@@ -39,10 +51,14 @@ type Info struct {
 	Description string
 	// Factory creates instances of this provider type.
 	Factory Factory
-	// RequiredFields lists the configuration fields required for this provider.
+	// Fields is the schema of this provider's config block, excluding type.
+	Fields []Field
+	// RequiredFields and OptionalFields list field names; Register derives
+	// them from Fields when they are not set.
 	RequiredFields []string
-	// OptionalFields lists optional configuration fields.
 	OptionalFields []string
+	// Capabilities lists what instances of this provider type support.
+	Capabilities Capabilities
 }
 
 // registry holds all registered provider types.
@@ -70,6 +86,9 @@ func Register(info Info) {
 	if _, exists := globalRegistry.providers[info.Type]; exists {
 		panic(fmt.Sprintf("provider type %q already registered", info.Type))
 	}
+	if info.RequiredFields == nil && info.OptionalFields == nil {
+		info.RequiredFields, info.OptionalFields = fieldNames(info.Fields)
+	}
 	globalRegistry.providers[info.Type] = info
 }
 
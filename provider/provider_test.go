@@ -25,6 +25,52 @@ func TestRegistry(t *testing.T) {
 	}
 }
 
+func TestDeclaredCapabilitiesMatchInterfaces(t *testing.T) {
+	instances := map[string]Provider{
+		"local-file":         &localFile{},
+		"local-store":        &localFile{},
+		"project-file":       &projectFile{},
+		"aws-ssm":            &awsSSM{},
+		"aws-secretsmanager": &awsSecretsManager{},
+		"vault":              &vaultProvider{},
+		"gcp-secretmanager":  &gcpSecretManager{},
+		"onepassword":        &onePassword{},
+		"doppler":            &doppler{},
+	}
+	for typ, p := range instances {
+		info, ok := Get(typ)
+		if !ok {
+			t.Errorf("provider %q not registered", typ)
+			continue
+		}
+		if !info.Capabilities.Has(CapRead) {
+			t.Errorf("provider %q should declare read", typ)
+		}
+		if _, ok := p.(Deleter); !ok {
+			t.Errorf("provider %q does not implement Deleter", typ)
+		}
+		instance := CapabilitiesOf(p)
+		for _, c := range []Capability{CapRead, CapWrite, CapDelete, CapMetadata, CapVersions} {
+			if info.Capabilities.Has(c) != instance.Has(c) {
+				t.Errorf("provider %q: declared %s=%v but instance reports %v", typ, c, info.Capabilities.Has(c), instance.Has(c))
+			}
+		}
+	}
+}
+
+func TestRequireCapabilities(t *testing.T) {
+	if err := RequireCapabilities(&doppler{}, "doppler-prod", CapRead); err != nil {
+		t.Errorf("doppler should support read: %v", err)
+	}
+	err := RequireCapabilities(&doppler{}, "doppler-prod", CapWrite)
+	if err == nil {
+		t.Fatal("doppler should not support write")
+	}
+	if want := "provider doppler-prod does not support write (supports: read, delete, batch)"; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+}
+
 func TestListTypes(t *testing.T) {
 	types := ListTypes()
 	if len(types) < 4 {
@@ -0,0 +1,324 @@
+package provider
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FieldType is the YAML type expected for a provider config field.
+type FieldType string
+
+const (
+	FieldString     FieldType = "string"
+	FieldInt        FieldType = "int"
+	FieldBool       FieldType = "bool"
+	FieldStringList FieldType = "list"
+	FieldObject     FieldType = "object"
+)
+
+// Field describes one key of a provider block in the global config.
+type Field struct {
+	Name     string
+	Type     FieldType
+	Required bool
+	// Default is the value used when the field is unset; nil means none.
+	Default any
+	// Env is consulted when the field is unset. A required field with an
+	// env fallback is only reported missing at runtime.
+	Env string
+	// Secret marks credentials that should come from Env rather than be
+	// written into the config file; PlaintextSecrets reports them.
+	Secret bool
+	// Values restricts a string field to a fixed set. An empty string is
+	// always accepted and means the field is unset.
+	Values []string
+	// Fields is the schema of a FieldObject.
+	Fields []Field
+}
+
+// encryptionFields is the schema of the encryption block shared by local stores.
+var encryptionFields = []Field{
+	{Name: "type", Type: FieldString, Values: []string{EncryptionTypePassphrase, EncryptionTypeAge}},
+	{Name: "key_file", Type: FieldString},
+	{Name: "key_env", Type: FieldString},
+	{Name: "kdf_time", Type: FieldInt, Default: int(defaultArgon2Params.Time)},
+	{Name: "kdf_memory", Type: FieldInt, Default: int(defaultArgon2Params.Memory)},
+	{Name: "kdf_threads", Type: FieldInt, Default: int(defaultArgon2Params.Threads)},
+	{Name: "recipients", Type: FieldStringList},
+	{Name: "identity_file", Type: FieldString},
+}
+
+// awsFields are the fields shared by the AWS providers.
+var awsFields = []Field{
+	{Name: "region", Type: FieldString, Required: true},
+	{Name: "profile", Type: FieldString},
+}
+
+func lookupField(fields []Field, name string) (Field, bool) {
+	for _, f := range fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// fieldNames splits a schema into required and optional field names.
+func fieldNames(fields []Field) (required, optional []string) {
+	for _, f := range fields {
+		if f.Required {
+			required = append(required, f.Name)
+		} else {
+			optional = append(optional, f.Name)
+		}
+	}
+	return required, optional
+}
+
+// configValues reads provider-specific fields from ProviderConfig.Extra
+// through a schema, applying env fallbacks and defaults.
+type configValues struct {
+	fields []Field
+	extra  map[string]any
+}
+
+func newConfigValues(fields []Field, cfg ProviderConfig) configValues {
+	return configValues{fields: fields, extra: cfg.Extra}
+}
+
+// String returns the configured string, then the env fallback, then the default.
+func (v configValues) String(name string) string {
+	if s, ok := v.extra[name].(string); ok && s != "" {
+		return s
+	}
+	f, _ := lookupField(v.fields, name)
+	if f.Env != "" {
+		if s := os.Getenv(f.Env); s != "" {
+			return s
+		}
+	}
+	if s, ok := f.Default.(string); ok {
+		return s
+	}
+	return ""
+}
+
+// FieldError is a schema violation in a provider block, positioned at the
+// offending YAML node.
+type FieldError struct {
+	Provider string
+	Field    string
+	Line     int
+	Column   int
+	Msg      string
+}
+
+func (e FieldError) Error() string {
+	if e.Provider == "" {
+		return fmt.Sprintf("%s: %s", e.Field, e.Msg)
+	}
+	if e.Field == "" {
+		return fmt.Sprintf("provider %q: %s", e.Provider, e.Msg)
+	}
+	return fmt.Sprintf("provider %q: %s: %s", e.Provider, e.Field, e.Msg)
+}
+
+// ValidateConfigNode checks a provider block against the schema of its type
+// and returns every problem found. node must be the block's mapping node.
+func ValidateConfigNode(name string, node *yaml.Node) []FieldError {
+	fail := func(n *yaml.Node, field, format string, args ...any) FieldError {
+		return FieldError{Provider: name, Field: field, Line: n.Line, Column: n.Column, Msg: fmt.Sprintf(format, args...)}
+	}
+	if node.Kind != yaml.MappingNode {
+		return []FieldError{fail(node, "", "expected a mapping, got %s", nodeKind(node))}
+	}
+	typeNode := mappingValue(node, "type")
+	if typeNode == nil || typeNode.Value == "" {
+		return []FieldError{fail(node, "type", "missing required field (one of: %s)", strings.Join(sortedTypes(), ", "))}
+	}
+	info, ok := Get(typeNode.Value)
+	if !ok {
+		return []FieldError{fail(typeNode, "type", "unknown provider type %q (one of: %s)", typeNode.Value, strings.Join(sortedTypes(), ", "))}
+	}
+	fields := append([]Field{{Name: "type", Type: FieldString, Required: true}}, info.Fields...)
+	return validateFields(name, "", node, fields)
+}
+
+func validateFields(provider, parent string, node *yaml.Node, fields []Field) []FieldError {
+	var errs []FieldError
+	fail := func(n *yaml.Node, field, format string, args ...any) {
+		errs = append(errs, FieldError{Provider: provider, Field: field, Line: n.Line, Column: n.Column, Msg: fmt.Sprintf(format, args...)})
+	}
+	seen := map[string]bool{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Value == "<<" {
+			continue // merge keys are resolved by the decoder
+		}
+		path := parent + key.Value
+		f, ok := lookupField(fields, key.Value)
+		if !ok {
+			if s := suggestField(key.Value, fields); s != "" {
+				fail(key, path, "unknown field (did you mean %q?)", s)
+			} else {
+				fail(key, path, "unknown field")
+			}
+			continue
+		}
+		if value.Tag == "!!null" {
+			continue
+		}
+		seen[f.Name] = true
+		switch f.Type {
+		case FieldString:
+			if value.Kind != yaml.ScalarNode || value.Tag != "!!str" {
+				fail(value, path, "expected string, got %s", nodeKind(value))
+			} else if len(f.Values) > 0 && value.Value != "" && !containsString(f.Values, value.Value) {
+				fail(value, path, "must be one of %s, got %q", strings.Join(f.Values, ", "), value.Value)
+			}
+		case FieldInt:
+			if value.Kind != yaml.ScalarNode || value.Tag != "!!int" {
+				fail(value, path, "expected integer, got %s", nodeKind(value))
+			}
+		case FieldBool:
+			if value.Kind != yaml.ScalarNode || value.Tag != "!!bool" {
+				fail(value, path, "expected true or false, got %s", nodeKind(value))
+			}
+		case FieldStringList:
+			if value.Kind != yaml.SequenceNode {
+				fail(value, path, "expected a list of strings, got %s", nodeKind(value))
+				break
+			}
+			for _, item := range value.Content {
+				if item.Kind != yaml.ScalarNode || item.Tag != "!!str" {
+					fail(item, path, "expected string list item, got %s", nodeKind(item))
+				}
+			}
+		case FieldObject:
+			if value.Kind != yaml.MappingNode {
+				fail(value, path, "expected a mapping, got %s", nodeKind(value))
+				break
+			}
+			errs = append(errs, validateFields(provider, path+".", value, f.Fields)...)
+		}
+	}
+	for _, f := range fields {
+		if f.Required && f.Env == "" && !seen[f.Name] {
+			fail(node, parent+f.Name, "missing required field")
+		}
+	}
+	return errs
+}
+
+// PlaintextSecrets returns a warning for every secret field given a literal
+// value in a provider block. Blocks with an unknown type are skipped; they
+// are already reported by ValidateConfigNode.
+func PlaintextSecrets(name string, node *yaml.Node) []FieldError {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	typeNode := mappingValue(node, "type")
+	if typeNode == nil {
+		return nil
+	}
+	info, ok := Get(typeNode.Value)
+	if !ok {
+		return nil
+	}
+	return plaintextSecrets(name, "", node, info.Fields)
+}
+
+func plaintextSecrets(provider, parent string, node *yaml.Node, fields []Field) []FieldError {
+	var warnings []FieldError
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		f, ok := lookupField(fields, key.Value)
+		if !ok {
+			continue
+		}
+		switch {
+		case f.Type == FieldObject && value.Kind == yaml.MappingNode:
+			warnings = append(warnings, plaintextSecrets(provider, parent+key.Value+".", value, f.Fields)...)
+		case f.Secret && value.Kind == yaml.ScalarNode && value.Value != "":
+			msg := "credential stored in plaintext"
+			if f.Env != "" {
+				msg += fmt.Sprintf("; set $%s instead", f.Env)
+			}
+			warnings = append(warnings, FieldError{Provider: provider, Field: parent + key.Value, Line: key.Line, Column: key.Column, Msg: msg})
+		}
+	}
+	return warnings
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// nodeKind names a node's type the way a config author would describe it.
+func nodeKind(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.MappingNode:
+		return "mapping"
+	case yaml.SequenceNode:
+		return "list"
+	case yaml.AliasNode:
+		return "alias"
+	}
+	switch n.Tag {
+	case "!!str":
+		return fmt.Sprintf("string %q", n.Value)
+	case "!!int":
+		return fmt.Sprintf("integer %s (quote it to use a string)", n.Value)
+	case "!!bool":
+		return fmt.Sprintf("boolean %s (quote it to use a string)", n.Value)
+	case "!!float":
+		return fmt.Sprintf("number %s", n.Value)
+	}
+	return strings.TrimPrefix(n.Tag, "!!")
+}
+
+// suggestField returns the closest known field name to a likely typo.
+func suggestField(name string, fields []Field) string {
+	best, bestDist := "", 3
+	for _, f := range fields {
+		if d := editDistance(name, f.Name); d < bestDist {
+			best, bestDist = f.Name, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func sortedTypes() []string {
+	types := ListTypes()
+	sort.Strings(types)
+	return types
+}
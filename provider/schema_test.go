@@ -0,0 +1,128 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func parseBlock(t *testing.T, src string) *yaml.Node {
+	t.Helper()
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(src), &root); err != nil {
+		t.Fatal(err)
+	}
+	return root.Content[0]
+}
+
+func TestValidateConfigNode(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string // substrings, one per expected error, in order
+	}{
+		{
+			name: "valid vault",
+			src:  "type: vault\naddress: https://vault:8200\nmount: kv\n",
+		},
+		{
+			name: "typo suggests field",
+			src:  "type: vault\nadress: https://vault:8200\n",
+			want: []string{`adress: unknown field (did you mean "address"?)`},
+		},
+		{
+			name: "unknown type",
+			src:  "type: hashicorp\n",
+			want: []string{`unknown provider type "hashicorp"`},
+		},
+		{
+			name: "missing type",
+			src:  "address: x\n",
+			want: []string{"type: missing required field"},
+		},
+		{
+			name: "wrong scalar type",
+			src:  "type: aws-secretsmanager\nregion: us-east-1\nforce_delete: \"yes\"\nrecovery_window_days: seven\n",
+			want: []string{"force_delete: expected true or false", "recovery_window_days: expected integer"},
+		},
+		{
+			name: "enum value",
+			src:  "type: vault\naddress: x\ndelete_mode: purge\n",
+			want: []string{"delete_mode: must be one of metadata, latest"},
+		},
+		{
+			name: "missing required without env fallback",
+			src:  "type: aws-ssm\nprofile: dev\n",
+			want: []string{"region: missing required field"},
+		},
+		{
+			name: "nested encryption block",
+			src:  "type: local-file\npath: /tmp/s.db\nencryption:\n  key_fiel: /tmp/k\n  recipients: age1abc\n",
+			want: []string{`encryption.key_fiel: unknown field (did you mean "key_file"?)`, "encryption.recipients: expected a list of strings"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateConfigNode("p", parseBlock(t, tt.src))
+			if len(errs) != len(tt.want) {
+				t.Fatalf("got %d errors %v, want %d", len(errs), errs, len(tt.want))
+			}
+			for i, w := range tt.want {
+				if !strings.Contains(errs[i].Error(), w) {
+					t.Errorf("error %d = %q, want it to contain %q", i, errs[i].Error(), w)
+				}
+				if errs[i].Line == 0 {
+					t.Errorf("error %d has no line position", i)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateConfigNodePosition(t *testing.T) {
+	errs := ValidateConfigNode("v", parseBlock(t, "type: vault\naddress: x\n  \nmonut: kv\n"))
+	if len(errs) != 1 {
+		t.Fatalf("got %v, want one error", errs)
+	}
+	if errs[0].Line != 4 || errs[0].Column != 1 {
+		t.Errorf("position = %d:%d, want 4:1", errs[0].Line, errs[0].Column)
+	}
+}
+
+func TestPlaintextSecrets(t *testing.T) {
+	warnings := PlaintextSecrets("v", parseBlock(t, "type: vault\naddress: x\ntoken: s.abc\n"))
+	if len(warnings) != 1 || warnings[0].Field != "token" || warnings[0].Line != 3 {
+		t.Fatalf("warnings = %v, want one for token at line 3", warnings)
+	}
+	if !strings.Contains(warnings[0].Error(), "$VAULT_TOKEN") {
+		t.Errorf("warning %q does not name the env fallback", warnings[0].Error())
+	}
+	if w := PlaintextSecrets("v", parseBlock(t, "type: vault\naddress: x\n")); len(w) != 0 {
+		t.Errorf("warnings without a token = %v", w)
+	}
+}
+
+func TestConfigValuesString(t *testing.T) {
+	fields := []Field{
+		{Name: "address", Type: FieldString, Env: "ENVMAP_TEST_ADDR"},
+		{Name: "mount", Type: FieldString, Default: "secret"},
+	}
+	t.Setenv("ENVMAP_TEST_ADDR", "from-env")
+
+	v := newConfigValues(fields, ProviderConfig{Extra: map[string]any{}})
+	if got := v.String("address"); got != "from-env" {
+		t.Errorf("address = %q, want env fallback", got)
+	}
+	if got := v.String("mount"); got != "secret" {
+		t.Errorf("mount = %q, want default", got)
+	}
+
+	v = newConfigValues(fields, ProviderConfig{Extra: map[string]any{"address": "cfg", "mount": "kv"}})
+	if got := v.String("address"); got != "cfg" {
+		t.Errorf("address = %q, want config value over env", got)
+	}
+	if got := v.String("mount"); got != "kv" {
+		t.Errorf("mount = %q, want config value over default", got)
+	}
+}
@@ -2,8 +2,8 @@ package provider
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"os"
 	"strings"
 
 	vault "github.com/hashicorp/vault/api"
@@ -11,17 +11,34 @@ import (
 
 func init() {
 	Register(Info{
-		Type:           "vault",
-		Description:    "HashiCorp Vault",
-		Factory:        newVault,
-		RequiredFields: []string{"address"},
-		OptionalFields: []string{"token", "mount", "namespace"},
+		Type:         "vault",
+		Description:  "HashiCorp Vault",
+		Factory:      newVault,
+		Fields:       vaultFields,
+		Capabilities: Capabilities{CapRead, CapWrite, CapDelete},
 	})
 }
 
+// Vault KV v2 delete modes: "metadata" permanently removes every version and
+// the key's metadata; "latest" soft-deletes the current version so it can
+// be recovered with vault kv undelete.
+const (
+	vaultDeleteMetadata = "metadata"
+	vaultDeleteLatest   = "latest"
+)
+
+var vaultFields = []Field{
+	{Name: "address", Type: FieldString, Required: true, Env: "VAULT_ADDR"},
+	{Name: "token", Type: FieldString, Env: "VAULT_TOKEN", Secret: true},
+	{Name: "mount", Type: FieldString, Default: "secret"},
+	{Name: "namespace", Type: FieldString, Env: "VAULT_NAMESPACE"},
+	{Name: "delete_mode", Type: FieldString, Default: vaultDeleteMetadata, Values: []string{vaultDeleteMetadata, vaultDeleteLatest}},
+}
+
 type vaultProvider struct {
 	client      *vault.Client
 	mount       string
+	deleteMode  string
 	envCfg      EnvConfig
 	providerCfg ProviderConfig
 }
@@ -31,9 +48,10 @@ func newVault(envCfg EnvConfig, providerCfg ProviderConfig) (Provider, error) {
 		providerCfg.Extra = map[string]any{}
 	}
 
-	address, ok := providerCfg.Extra["address"].(string)
-	if !ok || address == "" {
-		return nil, fmt.Errorf("vault provider requires address in config")
+	values := newConfigValues(vaultFields, providerCfg)
+	address := values.String("address")
+	if address == "" {
+		return nil, fmt.Errorf("vault provider requires address in config or VAULT_ADDR")
 	}
 
 	config := vault.DefaultConfig()
@@ -44,26 +62,25 @@ func newVault(envCfg EnvConfig, providerCfg ProviderConfig) (Provider, error) {
 		return nil, fmt.Errorf("init vault client: %w", err)
 	}
 
-	token := os.Getenv("VAULT_TOKEN")
-	if t, ok := providerCfg.Extra["token"].(string); ok && t != "" {
-		token = t
-	}
-	if token != "" {
+	if token := values.String("token"); token != "" {
 		client.SetToken(token)
 	}
 
-	if ns, ok := providerCfg.Extra["namespace"].(string); ok && ns != "" {
+	if ns := values.String("namespace"); ns != "" {
 		client.SetNamespace(ns)
 	}
 
-	mount := "secret"
-	if m, ok := providerCfg.Extra["mount"].(string); ok && m != "" {
-		mount = m
+	mount := values.String("mount")
+
+	deleteMode := values.String("delete_mode")
+	if deleteMode != vaultDeleteMetadata && deleteMode != vaultDeleteLatest {
+		return nil, fmt.Errorf("vault delete_mode must be %q or %q, got %q", vaultDeleteMetadata, vaultDeleteLatest, deleteMode)
 	}
 
 	return &vaultProvider{
 		client:      client,
 		mount:       mount,
+		deleteMode:  deleteMode,
 		envCfg:      envCfg,
 		providerCfg: providerCfg,
 	}, nil
@@ -75,6 +92,11 @@ func (p *vaultProvider) secretPath(name string) string {
 }
 
 func (p *vaultProvider) Get(ctx context.Context, name string) (string, error) {
+	return p.GetField(ctx, name, "value")
+}
+
+// GetField reads one field of a KV v2 secret.
+func (p *vaultProvider) GetField(ctx context.Context, name, field string) (string, error) {
 	path := p.secretPath(name)
 	secret, err := p.client.Logical().ReadWithContext(ctx, path)
 	if err != nil {
@@ -89,11 +111,19 @@ func (p *vaultProvider) Get(ctx context.Context, name string) (string, error) {
 		return "", fmt.Errorf("vault secret %s has unexpected format", path)
 	}
 
-	value, ok := data["value"].(string)
+	raw, ok := data[field]
 	if !ok {
-		return "", fmt.Errorf("vault secret %s missing 'value' field", path)
+		return "", fmt.Errorf("vault secret %s missing '%s' field", path, field)
+	}
+	if value, ok := raw.(string); ok {
+		return value, nil
 	}
-	return value, nil
+	// Numbers, booleans and nested objects come back as their JSON encoding.
+	out, err := json.Marshal(raw)
+	if err != nil {
+		return "", fmt.Errorf("vault secret %s field '%s': %w", path, field, err)
+	}
+	return string(out), nil
 }
 
 func (p *vaultProvider) List(ctx context.Context, prefix string) (map[string]string, error) {
@@ -142,3 +172,14 @@ func (p *vaultProvider) Set(ctx context.Context, name, value string) error {
 	}
 	return nil
 }
+
+func (p *vaultProvider) Delete(ctx context.Context, name string) error {
+	path := p.secretPath(name)
+	if p.deleteMode == vaultDeleteMetadata {
+		path = fmt.Sprintf("%s/metadata/%s", p.mount, ApplyPrefix(p.envCfg, name))
+	}
+	if _, err := p.client.Logical().DeleteWithContext(ctx, path); err != nil {
+		return fmt.Errorf("vault delete %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/binsquare/envmap/provider"
+	"github.com/spf13/cobra"
+)
+
+// checkProbePrefix is listed by `providers check`. It is not expected to
+// exist, so the read exercises auth and connectivity while returning nothing;
+// some backends still fetch every value to filter by it.
+const checkProbePrefix = "envmap-check-probe/"
+
+func newProvidersCmd() *cobra.Command {
+	list := newProvidersListCmd()
+	c := &cobra.Command{
+		Use:   "providers",
+		Short: "Inspect registered provider types and configured backends",
+		Args:  cobra.NoArgs,
+		RunE:  list.RunE,
+	}
+	c.Flags().AddFlagSet(list.Flags())
+	c.AddCommand(list, newProvidersCheckCmd())
+	return c
+}
+
+type providerTypeJSON struct {
+	Type           string   `json:"type"`
+	Description    string   `json:"description"`
+	RequiredFields []string `json:"required_fields"`
+	OptionalFields []string `json:"optional_fields"`
+	Capabilities   []string `json:"capabilities"`
+}
+
+type configuredProviderJSON struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+func newProvidersListCmd() *cobra.Command {
+	var asJSON bool
+	c := &cobra.Command{
+		Use:   "list",
+		Short: "List registered provider types and the providers configured in ~/.envmap/config.yaml",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			infos := provider.List()
+			sort.Slice(infos, func(i, j int) bool { return infos[i].Type < infos[j].Type })
+
+			// A missing global config is not an error here; the registry is still useful.
+			var configured []configuredProviderJSON
+			if globalCfg, err := LoadGlobalConfig(""); err == nil {
+				for name, cfg := range globalCfg.GetProviders() {
+					configured = append(configured, configuredProviderJSON{Name: name, Type: cfg.Type})
+				}
+				sort.Slice(configured, func(i, j int) bool { return configured[i].Name < configured[j].Name })
+			}
+
+			if asJSON {
+				out := struct {
+					Types      []providerTypeJSON       `json:"types"`
+					Configured []configuredProviderJSON `json:"configured"`
+				}{Types: []providerTypeJSON{}, Configured: configured}
+				if out.Configured == nil {
+					out.Configured = []configuredProviderJSON{}
+				}
+				for _, info := range infos {
+					caps := make([]string, 0, len(info.Capabilities))
+					for _, c := range info.Capabilities {
+						caps = append(caps, string(c))
+					}
+					out.Types = append(out.Types, providerTypeJSON{
+						Type:           info.Type,
+						Description:    info.Description,
+						RequiredFields: nonNil(info.RequiredFields),
+						OptionalFields: nonNil(info.OptionalFields),
+						Capabilities:   caps,
+					})
+				}
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(out)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "TYPE\tREQUIRED\tOPTIONAL\tCAPABILITIES\tDESCRIPTION")
+			for _, info := range infos {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", info.Type, fieldList(info.RequiredFields), fieldList(info.OptionalFields), info.Capabilities, info.Description)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			if len(configured) > 0 {
+				fmt.Printf("\nConfigured in %s:\n", DefaultGlobalConfigPath())
+				w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				for _, p := range configured {
+					fmt.Fprintf(w, "  %s\t%s\n", p.Name, p.Type)
+				}
+				return w.Flush()
+			}
+			return nil
+		},
+	}
+	c.Flags().BoolVar(&asJSON, "json", false, "output JSON")
+	return c
+}
+
+// ProviderCheck is the result of probing one configured provider.
+type ProviderCheck struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	OK        bool   `json:"ok"`
+	Stage     string `json:"stage,omitempty"`    // "config" or "read" when the check failed
+	Category  string `json:"category,omitempty"` // "config", "auth", "connectivity", "timeout" or "error"
+	Error     string `json:"error,omitempty"`
+	LatencyMS int64  `json:"latency_ms"`
+}
+
+func newProvidersCheckCmd() *cobra.Command {
+	var asJSON bool
+	var timeout time.Duration
+	c := &cobra.Command{
+		Use:   "check [NAME]",
+		Short: "Instantiate configured providers and perform a harmless read",
+		Long: `Instantiate a provider from ~/.envmap/config.yaml and list a prefix that is
+not expected to exist, reporting whether auth and connectivity work and how
+long the round trip took. No secret values are printed, but backends that
+cannot list names alone (local-file, doppler, onepassword) fetch and decrypt
+every value to answer the list.
+
+Without NAME every configured provider is checked.
+
+Examples:
+  envmap providers check vault-prod
+  envmap providers check --json | jq '.[] | select(.ok | not)'`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			globalCfg, err := LoadGlobalConfig("")
+			if err != nil {
+				return err
+			}
+			if warnings, err := globalConfigWarnings(""); err == nil {
+				for _, w := range warnings {
+					fmt.Fprintf(os.Stderr, "envmap: warning: %s:%d: %s\n", DefaultGlobalConfigPath(), w.Line, w.Error())
+				}
+			}
+			providers := globalCfg.GetProviders()
+			var names []string
+			if len(args) == 1 {
+				if _, ok := providers[args[0]]; !ok {
+					return fmt.Errorf("no provider named %q configured in %s", args[0], DefaultGlobalConfigPath())
+				}
+				names = []string{args[0]}
+			} else {
+				for name := range providers {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+			}
+
+			results := make([]ProviderCheck, 0, len(names))
+			failed := 0
+			for _, name := range names {
+				ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+				res := checkProvider(ctx, name, globalCfg)
+				cancel()
+				if !res.OK {
+					failed++
+				}
+				results = append(results, res)
+			}
+
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(results); err != nil {
+					return err
+				}
+			} else {
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "NAME\tTYPE\tSTATUS\tLATENCY\tDETAIL")
+				for _, r := range results {
+					status := "ok"
+					if !r.OK {
+						status = r.Category
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%dms\t%s\n", r.Name, r.Type, status, r.LatencyMS, r.Error)
+				}
+				if err := w.Flush(); err != nil {
+					return err
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d provider checks failed", failed, len(results))
+			}
+			return nil
+		},
+	}
+	c.Flags().BoolVar(&asJSON, "json", false, "output JSON")
+	c.Flags().DurationVar(&timeout, "timeout", 10*time.Second, "per-provider timeout")
+	return c
+}
+
+// checkProvider builds the named provider through NewProvider and lists
+// checkProbePrefix, classifying any failure. Latency covers the read only.
+func checkProvider(ctx context.Context, name string, globalCfg GlobalConfig) ProviderCheck {
+	res := ProviderCheck{Name: name, Type: globalCfg.GetProviders()[name].Type}
+	p, err := NewProvider("providers check", EnvConfig{Provider: name}, globalCfg)
+	if err != nil {
+		res.Stage, res.Category, res.Error = "config", "config", err.Error()
+		return res
+	}
+	start := time.Now()
+	_, err = p.List(ctx, checkProbePrefix)
+	res.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		res.Stage, res.Category, res.Error = "read", classifyCheckError(err), err.Error()
+		return res
+	}
+	res.OK = true
+	return res
+}
+
+// classifyCheckError makes a best-effort guess at why a probe failed. Backends
+// wrap their SDK errors differently, so this falls back to matching text.
+func classifyCheckError(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	var netErr net.Error
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) || errors.As(err, &opErr) {
+		return "connectivity"
+	}
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"401", "403", "unauthorized", "forbidden", "access denied", "accessdenied", "permission denied", "invalid token", "expired", "credentials", "unauthenticated", "incorrect passphrase", "different key", "age identities"} {
+		if strings.Contains(msg, s) {
+			return "auth"
+		}
+	}
+	for _, s := range []string{"connection refused", "no such host", "dial tcp", "tls:", "eof", "network is unreachable"} {
+		if strings.Contains(msg, s) {
+			return "connectivity"
+		}
+	}
+	return "error"
+}
+
+func fieldList(fields []string) string {
+	if len(fields) == 0 {
+		return "-"
+	}
+	return strings.Join(fields, ",")
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/binsquare/envmap/provider"
+)
+
+func TestCheckProviderLocalFile(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "key")
+	if err := provider.GenerateKeyFile(keyPath); err != nil {
+		t.Fatal(err)
+	}
+	globalCfg := GlobalConfig{Providers: map[string]provider.ProviderConfig{
+		"local": {
+			Type:       "local-file",
+			Path:       filepath.Join(dir, "secrets.db"),
+			Encryption: &provider.EncryptionConfig{KeyFile: keyPath},
+		},
+		"broken": {
+			Type:       "local-file",
+			Path:       filepath.Join(dir, "other.db"),
+			Encryption: &provider.EncryptionConfig{KeyFile: filepath.Join(dir, "missing")},
+		},
+	}}
+
+	res := checkProvider(context.Background(), "local", globalCfg)
+	if !res.OK || res.Type != "local-file" || res.Error != "" {
+		t.Errorf("local check = %+v, want ok", res)
+	}
+	res = checkProvider(context.Background(), "broken", globalCfg)
+	if res.OK || res.Stage != "config" || res.Category != "config" || res.Error == "" {
+		t.Errorf("broken check = %+v, want config failure", res)
+	}
+}
+
+func TestClassifyCheckError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("list: %w", context.DeadlineExceeded), "timeout"},
+		{fmt.Errorf("vault list: %w", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}), "connectivity"},
+		{errors.New("vault list secret/metadata/x: Code: 403. permission denied"), "auth"},
+		{errors.New("aws ssm list /x: AccessDeniedException: not authorized"), "auth"},
+		{errors.New("doppler list returned status 401"), "auth"},
+		{errors.New("something odd happened"), "error"},
+	}
+	for _, tt := range tests {
+		if got := classifyCheckError(tt.err); got != tt.want {
+			t.Errorf("classifyCheckError(%q) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
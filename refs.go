@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/binsquare/envmap/provider"
+)
+
+// refSchemes maps secret reference URI schemes to the provider types they
+// address. A value that is exactly such a URI is replaced by the secret it
+// points at, e.g. vault://kv/shared/stripe#api_key or ssm:///shared/db/password.
+// A leading backslash, as in \op://vault/item, keeps the URI literal.
+var refSchemes = map[string][]string{
+	"vault":          {"vault"},
+	"ssm":            {"aws-ssm"},
+	"secretsmanager": {"aws-secretsmanager"},
+	"gcp":            {"gcp-secretmanager"},
+	"op":             {"onepassword"},
+	"doppler":        {"doppler"},
+	"local":          {"local-file", "local-store"},
+	"project":        {"project-file"},
+}
+
+// maxRefDepth bounds chains of references to references.
+const maxRefDepth = 8
+
+// secretRef is a parsed scheme://host/path#field reference.
+type secretRef struct {
+	Scheme string
+	Host   string
+	Path   string
+	Field  string
+}
+
+// parseSecretRef reports whether value is a secret reference.
+func parseSecretRef(value string) (secretRef, bool) {
+	scheme, rest, ok := strings.Cut(value, "://")
+	if !ok {
+		return secretRef{}, false
+	}
+	if _, known := refSchemes[scheme]; !known || strings.ContainsAny(rest, " \t\n") {
+		return secretRef{}, false
+	}
+	ref := secretRef{Scheme: scheme}
+	if i := strings.LastIndexByte(rest, '#'); i >= 0 {
+		rest, ref.Field = rest[:i], rest[i+1:]
+	}
+	ref.Host, ref.Path = rest, ""
+	if i := strings.IndexByte(rest, '/'); i >= 0 {
+		ref.Host, ref.Path = rest[:i], rest[i:]
+	}
+	if ref.Host == "" && strings.Trim(ref.Path, "/") == "" {
+		return secretRef{}, false
+	}
+	return ref, true
+}
+
+func (r secretRef) String() string {
+	s := r.Scheme + "://" + r.Host + r.Path
+	if r.Field != "" {
+		s += "#" + r.Field
+	}
+	return s
+}
+
+// refCache holds provider instances and resolved values for one command.
+type refCache struct {
+	providers map[string]provider.Provider
+	values    map[string]string
+}
+
+type refCacheKey struct{}
+
+// withRefCache attaches a reference cache so every lookup made while serving
+// a command reuses providers and values.
+func withRefCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, refCacheKey{}, &refCache{
+		providers: map[string]provider.Provider{},
+		values:    map[string]string{},
+	})
+}
+
+// refResolver replaces reference values with the secrets they point at.
+type refResolver struct {
+	globalCfg GlobalConfig
+	cache     *refCache
+}
+
+func newRefResolver(ctx context.Context, globalCfg GlobalConfig) *refResolver {
+	cache, ok := ctx.Value(refCacheKey{}).(*refCache)
+	if !ok {
+		cache = &refCache{providers: map[string]provider.Provider{}, values: map[string]string{}}
+	}
+	return &refResolver{globalCfg: globalCfg, cache: cache}
+}
+
+// ResolveRecords resolves the reference values in records in place, skipping
+// the keys for which literal reports true.
+func (r *refResolver) ResolveRecords(ctx context.Context, records map[string]provider.SecretRecord, literal func(key string) bool) error {
+	keys := make([]string, 0, len(records))
+	for k := range records {
+		if literal == nil || !literal(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		rec := records[k]
+		value, err := r.Resolve(ctx, rec.Value)
+		if err != nil {
+			return fmt.Errorf("secret %s: %w", k, err)
+		}
+		rec.Value = value
+		records[k] = rec
+	}
+	return nil
+}
+
+// Resolve follows value while it is a reference and returns the final secret.
+func (r *refResolver) Resolve(ctx context.Context, value string) (string, error) {
+	for depth := 0; ; depth++ {
+		if escaped, ok := strings.CutPrefix(value, `\`); ok {
+			if _, isRef := parseSecretRef(escaped); isRef {
+				return escaped, nil
+			}
+		}
+		ref, ok := parseSecretRef(value)
+		if !ok {
+			return value, nil
+		}
+		if depth == maxRefDepth {
+			return "", fmt.Errorf("reference chain longer than %d at %s", maxRefDepth, ref)
+		}
+		resolved, err := r.lookup(ctx, ref)
+		if err != nil {
+			return "", fmt.Errorf("resolve %s: %w", ref, err)
+		}
+		value = resolved
+	}
+}
+
+func (r *refResolver) lookup(ctx context.Context, ref secretRef) (string, error) {
+	if v, ok := r.cache.values[ref.String()]; ok {
+		return v, nil
+	}
+	name, providerCfg, key, err := r.target(ref)
+	if err != nil {
+		return "", err
+	}
+	cacheKey := name
+	if mount, ok := providerCfg.Extra["mount"].(string); ok {
+		cacheKey += "\x00" + mount
+	}
+	p, ok := r.cache.providers[cacheKey]
+	if !ok {
+		p, err = newProviderFromConfig(name, EnvConfig{Provider: name}, providerCfg)
+		if err != nil {
+			return "", err
+		}
+		r.cache.providers[cacheKey] = p
+	}
+	var value string
+	if fg, ok := p.(provider.FieldGetter); ok && ref.Field != "" {
+		value, err = fg.GetField(ctx, key, ref.Field)
+	} else {
+		value, err = p.Get(ctx, key)
+		if err == nil && ref.Field != "" {
+			value, err = jsonField(value, ref.Field)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	r.cache.values[ref.String()] = value
+	return value, nil
+}
+
+// target picks the configured provider a reference addresses. The host names
+// a provider when one of the scheme's type is configured under that name;
+// otherwise the only configured provider of that type is used and the host
+// is part of the key.
+func (r *refResolver) target(ref secretRef) (string, provider.ProviderConfig, string, error) {
+	types := refSchemes[ref.Scheme]
+	providers := r.globalCfg.GetProviders()
+	name, key := "", ref.Host+ref.Path
+	if cfg, ok := providers[ref.Host]; ok && ref.Host != "" && containsType(types, cfg.Type) {
+		name, key = ref.Host, ref.Path
+	} else {
+		var candidates []string
+		for n, cfg := range providers {
+			if containsType(types, cfg.Type) {
+				candidates = append(candidates, n)
+			}
+		}
+		sort.Strings(candidates)
+		switch len(candidates) {
+		case 0:
+			return "", provider.ProviderConfig{}, "", fmt.Errorf("no %s provider configured in %s", strings.Join(types, " or "), DefaultGlobalConfigPath())
+		case 1:
+			name = candidates[0]
+		default:
+			return "", provider.ProviderConfig{}, "", fmt.Errorf("several %s providers configured (%s); name one as the host, e.g. %s://%s/...", strings.Join(types, " or "), strings.Join(candidates, ", "), ref.Scheme, candidates[0])
+		}
+	}
+	providerCfg := providers[name]
+	switch providerCfg.Type {
+	case "aws-ssm":
+		// Parameter names are absolute paths.
+		key = "/" + strings.TrimPrefix(key, "/")
+	case "vault":
+		// The first path segment is the KV mount.
+		mount, rest, ok := strings.Cut(strings.TrimPrefix(key, "/"), "/")
+		if !ok || mount == "" || rest == "" {
+			return "", provider.ProviderConfig{}, "", fmt.Errorf("vault reference needs a mount and a path, e.g. vault://kv/shared/stripe")
+		}
+		extra := make(map[string]any, len(providerCfg.Extra)+1)
+		for k, v := range providerCfg.Extra {
+			extra[k] = v
+		}
+		extra["mount"] = mount
+		providerCfg.Extra = extra
+		key = rest
+	default:
+		key = strings.TrimPrefix(key, "/")
+	}
+	return name, providerCfg, key, nil
+}
+
+func containsType(types []string, t string) bool {
+	for _, candidate := range types {
+		if candidate == t {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonField extracts a field from a secret stored as a JSON object.
+func jsonField(value, field string) (string, error) {
+	var obj map[string]any
+	if err := json.Unmarshal([]byte(value), &obj); err != nil {
+		return "", fmt.Errorf("field %q requested but the secret is not a JSON object", field)
+	}
+	v, ok := obj[field]
+	if !ok {
+		return "", fmt.Errorf("secret has no field %q", field)
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
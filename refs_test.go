@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/binsquare/envmap/provider"
+)
+
+func TestParseSecretRef(t *testing.T) {
+	tests := []struct {
+		in   string
+		want secretRef
+		ok   bool
+	}{
+		{"vault://kv/shared/stripe#value", secretRef{Scheme: "vault", Host: "kv", Path: "/shared/stripe", Field: "value"}, true},
+		{"ssm:///shared/db/password", secretRef{Scheme: "ssm", Path: "/shared/db/password"}, true},
+		{"local://canon/db", secretRef{Scheme: "local", Host: "canon", Path: "/db"}, true},
+		{"https://example.com/x", secretRef{}, false},
+		{"postgres://u:p@db/app", secretRef{}, false},
+		{"ssm://", secretRef{}, false},
+		{"vault://kv/a b", secretRef{}, false},
+		{"plain value", secretRef{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseSecretRef(tt.in)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseSecretRef(%q) = %+v, %v; want %+v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestJSONField(t *testing.T) {
+	if v, err := jsonField(`{"user":"app","port":5432}`, "user"); err != nil || v != "app" {
+		t.Errorf("user = %q, %v", v, err)
+	}
+	if v, err := jsonField(`{"user":"app","port":5432}`, "port"); err != nil || v != "5432" {
+		t.Errorf("port = %q, %v", v, err)
+	}
+	if _, err := jsonField(`not json`, "user"); err == nil {
+		t.Error("jsonField accepted non-JSON value")
+	}
+}
+
+func TestCollectEnvResolvesRefs(t *testing.T) {
+	projectCfg, globalCfg := localTestConfig(t)
+	ctx := withRefCache(context.Background())
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "key")
+	if err := provider.GenerateKeyFile(keyPath); err != nil {
+		t.Fatal(err)
+	}
+	globalCfg.Providers["canon"] = provider.ProviderConfig{
+		Type:       "local-file",
+		Path:       filepath.Join(dir, "canon.db"),
+		Encryption: &provider.EncryptionConfig{KeyFile: keyPath},
+	}
+	projectCfg.Envs["canon"] = EnvConfig{Provider: "canon"}
+
+	if err := WriteSecret(ctx, projectCfg, globalCfg, "canon", "shared/db", `{"password":"hunter2"}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteSecret(ctx, projectCfg, globalCfg, "canon", "shared/stripe", "sk_live"); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]string{
+		"DB_PASSWORD": "local://canon/shared/db#password",
+		"STRIPE_KEY":  "local://canon/shared/stripe",
+		"PLAIN":       "https://example.com",
+		"ESCAPED":     `\local://canon/shared/stripe`,
+	} {
+		if err := WriteSecret(ctx, projectCfg, globalCfg, "dev", k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := CollectEnv(ctx, projectCfg, globalCfg, "dev")
+	if err != nil {
+		t.Fatalf("CollectEnv: %v", err)
+	}
+	want := map[string]string{"DB_PASSWORD": "hunter2", "STRIPE_KEY": "sk_live", "PLAIN": "https://example.com", "ESCAPED": "local://canon/shared/stripe"}
+	for k, w := range want {
+		if got[k] != w {
+			t.Errorf("%s = %q, want %q", k, got[k], w)
+		}
+	}
+	if v, err := FetchSecret(ctx, projectCfg, globalCfg, "dev", "STRIPE_KEY"); err != nil || v != "sk_live" {
+		t.Errorf("FetchSecret(STRIPE_KEY) = %q, %v", v, err)
+	}
+
+	// Two local-file providers are configured, so the host must name one.
+	if err := WriteSecret(ctx, projectCfg, globalCfg, "dev", "AMBIGUOUS", "local://shared/stripe"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CollectEnv(ctx, projectCfg, globalCfg, "dev"); err == nil || !strings.Contains(err.Error(), "several") {
+		t.Errorf("CollectEnv error = %v, want ambiguous provider", err)
+	}
+
+	// With resolve_refs: false every value is taken literally.
+	dev := projectCfg.Envs["dev"]
+	off := false
+	dev.ResolveRefs = &off
+	projectCfg.Envs["dev"] = dev
+	got, err = CollectEnv(ctx, projectCfg, globalCfg, "dev")
+	if err != nil {
+		t.Fatalf("CollectEnv with resolve_refs off: %v", err)
+	}
+	if got["AMBIGUOUS"] != "local://shared/stripe" || got["ESCAPED"] != `\local://canon/shared/stripe` {
+		t.Errorf("literal values = %q, %q", got["AMBIGUOUS"], got["ESCAPED"])
+	}
+	if v, err := FetchSecret(ctx, projectCfg, globalCfg, "dev", "STRIPE_KEY"); err != nil || v != "local://canon/shared/stripe" {
+		t.Errorf("FetchSecret(STRIPE_KEY) with resolve_refs off = %q, %v", v, err)
+	}
+}
+
+func TestResolveRefChainLimit(t *testing.T) {
+	projectCfg, globalCfg := localTestConfig(t)
+	ctx := context.Background()
+	if err := WriteSecret(ctx, projectCfg, globalCfg, "dev", "LOOP", "local://local/demo/dev/LOOP"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := CollectEnv(ctx, projectCfg, globalCfg, "dev")
+	if err == nil || !strings.Contains(err.Error(), "reference chain longer than") {
+		t.Errorf("CollectEnv error = %v, want chain limit", err)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/binsquare/envmap/provider"
+)
+
+// rotateLocalKey moves the local store for providerName to a new key. With
+// newKeyEnv set, the store is re-encrypted under that env var's value;
+// passphrase stores prompt for a new passphrase; otherwise a fresh key file
+// replaces the configured key_file in place.
+func rotateLocalKey(ctx context.Context, globalCfg GlobalConfig, providerName, newKeyEnv string) error {
+	name, providerCfg, err := selectLocalProvider(globalCfg, providerName)
+	if err != nil {
+		return err
+	}
+	providerCfg, err = withPromptedPassphrase(name, providerCfg)
+	if err != nil {
+		return err
+	}
+	oldEnc := providerCfg.Encryption
+	if oldEnc == nil {
+		return fmt.Errorf("provider %q has no encryption configuration", name)
+	}
+	if oldEnc.Type == provider.EncryptionTypeAge {
+		return fmt.Errorf("provider %q is encrypted to age recipients; use envmap recipients add/remove instead", name)
+	}
+	if shared := providersSharingKey(globalCfg, name, oldEnc); len(shared) > 0 {
+		return fmt.Errorf("key for provider %q is also used by %v; rotate those stores to separate keys first", name, shared)
+	}
+
+	if oldEnc.IsPassphrase() {
+		newEnc := *oldEnc
+		newEnc.KeyEnv = newKeyEnv
+		newEnc.Passphrase = ""
+		if newKeyEnv == "" {
+			passphrase, err := readPassphrase("New passphrase: ", true)
+			if err != nil {
+				return err
+			}
+			newEnc.Passphrase = passphrase
+		}
+		if err := provider.RotateKey(providerCfg.Path, oldEnc, &newEnc); err != nil {
+			return err
+		}
+		delete(promptedPassphrases, name)
+		fmt.Printf("Re-encrypted %s under the new passphrase\n", providerCfg.Path)
+		if newKeyEnv != "" {
+			fmt.Printf("Update encryption for provider %q in %s to key_env: %s\n", name, DefaultGlobalConfigPath(), newKeyEnv)
+		}
+		return nil
+	}
+
+	if newKeyEnv != "" {
+		if err := provider.RotateKey(providerCfg.Path, oldEnc, &provider.EncryptionConfig{KeyEnv: newKeyEnv}); err != nil {
+			return err
+		}
+		fmt.Printf("Re-encrypted %s with key from $%s\n", providerCfg.Path, newKeyEnv)
+		fmt.Printf("Update encryption for provider %q in %s to key_env: %s\n", name, DefaultGlobalConfigPath(), newKeyEnv)
+		return nil
+	}
+
+	if oldEnc.KeyEnv != "" {
+		return fmt.Errorf("provider %q reads its key from $%s; pass --new-key-env to rotate to a new env var", name, oldEnc.KeyEnv)
+	}
+	if oldEnc.KeyFile == "" {
+		return fmt.Errorf("provider %q has neither encryption.key_file nor encryption.key_env set in %s", name, DefaultGlobalConfigPath())
+	}
+	keyFile := oldEnc.KeyFile
+	newKeyFile := keyFile + ".new"
+	backupFile := keyFile + ".bak"
+	if _, err := os.Stat(newKeyFile); err == nil {
+		return fmt.Errorf("%s already exists from an earlier rotation; remove it first", newKeyFile)
+	}
+	if err := provider.GenerateKeyFile(newKeyFile); err != nil {
+		return err
+	}
+	if err := copyFile(keyFile, backupFile); err != nil {
+		os.Remove(newKeyFile)
+		return fmt.Errorf("backup current key: %w", err)
+	}
+	if err := provider.RotateKey(providerCfg.Path, oldEnc, &provider.EncryptionConfig{KeyFile: newKeyFile}); err != nil {
+		os.Remove(newKeyFile)
+		os.Remove(backupFile)
+		return err
+	}
+	if err := os.Rename(newKeyFile, keyFile); err != nil {
+		return fmt.Errorf("store is now encrypted with %s but installing it failed: %w (previous key kept at %s)", newKeyFile, err, backupFile)
+	}
+
+	// Reopen through the normal factory path before discarding the old key.
+	if err := verifyLocalStore(ctx, providerCfg); err != nil {
+		return fmt.Errorf("verify rotated store: %w (previous key kept at %s)", err, backupFile)
+	}
+	if err := os.Remove(backupFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove key backup %s: %w", backupFile, err)
+	}
+	fmt.Printf("Rotated key %s and re-encrypted %s\n", keyFile, providerCfg.Path)
+	fmt.Println("Distribute the new key to anyone who shares this store; the old key no longer decrypts it.")
+	return nil
+}
+
+func verifyLocalStore(ctx context.Context, providerCfg provider.ProviderConfig) error {
+	info, ok := provider.Get(providerCfg.Type)
+	if !ok {
+		return fmt.Errorf("unknown provider type %q", providerCfg.Type)
+	}
+	p, err := info.Factory(provider.EnvConfig{}, providerCfg)
+	if err != nil {
+		return err
+	}
+	_, err = p.List(ctx, "")
+	return err
+}
+
+func selectLocalProvider(globalCfg GlobalConfig, providerName string) (string, provider.ProviderConfig, error) {
+	providers := globalCfg.GetProviders()
+	if providerName != "" {
+		cfg, ok := providers[providerName]
+		if !ok {
+			return "", provider.ProviderConfig{}, fmt.Errorf("no provider named %q configured in %s", providerName, DefaultGlobalConfigPath())
+		}
+		if !isLocalType(cfg.Type) {
+			return "", provider.ProviderConfig{}, fmt.Errorf("provider %q is type %s; key rotation only applies to local-file stores", providerName, cfg.Type)
+		}
+		return providerName, cfg, nil
+	}
+	var names []string
+	for name, cfg := range providers {
+		if isLocalType(cfg.Type) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	switch len(names) {
+	case 0:
+		return "", provider.ProviderConfig{}, errors.New("no local-file providers configured")
+	case 1:
+		return names[0], providers[names[0]], nil
+	default:
+		return "", provider.ProviderConfig{}, fmt.Errorf("multiple local-file providers configured %v; choose one with --provider", names)
+	}
+}
+
+func providersSharingKey(globalCfg GlobalConfig, name string, enc *provider.EncryptionConfig) []string {
+	var shared []string
+	for other, cfg := range globalCfg.GetProviders() {
+		if other == name || !isLocalType(cfg.Type) || cfg.Encryption == nil {
+			continue
+		}
+		if (enc.KeyFile != "" && cfg.Encryption.KeyFile == enc.KeyFile) || (enc.KeyEnv != "" && cfg.Encryption.KeyEnv == enc.KeyEnv) {
+			shared = append(shared, other)
+		}
+	}
+	sort.Strings(shared)
+	return shared
+}
+
+func isLocalType(providerType string) bool {
+	return providerType == "local-file" || providerType == "local-store"
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/binsquare/envmap/provider"
+)
+
+func TestRotateLocalKeyReplacesKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "key")
+	if err := provider.GenerateKeyFile(keyPath); err != nil {
+		t.Fatal(err)
+	}
+	oldKey, err := os.ReadFile(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	providerCfg := provider.ProviderConfig{
+		Type:       "local-file",
+		Path:       filepath.Join(dir, "secrets.db"),
+		Encryption: &provider.EncryptionConfig{KeyFile: keyPath},
+	}
+	info, _ := provider.Get("local-file")
+	p, err := info.Factory(provider.EnvConfig{}, providerCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := p.Set(ctx, "TOKEN", "abc123"); err != nil {
+		t.Fatal(err)
+	}
+
+	globalCfg := GlobalConfig{Providers: map[string]provider.ProviderConfig{"local": providerCfg}}
+	if err := rotateLocalKey(ctx, globalCfg, "", ""); err != nil {
+		t.Fatalf("rotateLocalKey: %v", err)
+	}
+
+	newKey, err := os.ReadFile(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(newKey) == string(oldKey) {
+		t.Error("key file was not replaced")
+	}
+	for _, leftover := range []string{keyPath + ".new", keyPath + ".bak"} {
+		if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed after successful rotation", leftover)
+		}
+	}
+
+	p, err = info.Factory(provider.EnvConfig{}, providerCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	val, err := p.Get(ctx, "TOKEN")
+	if err != nil {
+		t.Fatalf("Get after rotation: %v", err)
+	}
+	if val != "abc123" {
+		t.Errorf("value after rotation = %q, want %q", val, "abc123")
+	}
+}
+
+func TestSelectLocalProviderRequiresChoice(t *testing.T) {
+	globalCfg := GlobalConfig{Providers: map[string]provider.ProviderConfig{
+		"a":     {Type: "local-file"},
+		"b":     {Type: "local-store"},
+		"vault": {Type: "vault"},
+	}}
+	if _, _, err := selectLocalProvider(globalCfg, ""); err == nil {
+		t.Error("expected error when several local providers are configured")
+	}
+	if name, _, err := selectLocalProvider(globalCfg, "b"); err != nil || name != "b" {
+		t.Errorf("selectLocalProvider(b) = %q, %v", name, err)
+	}
+	if _, _, err := selectLocalProvider(globalCfg, "vault"); err == nil {
+		t.Error("expected error selecting a non-local provider")
+	}
+}
+
+func TestRotateLocalKeyWithoutKeySource(t *testing.T) {
+	globalCfg := GlobalConfig{Providers: map[string]provider.ProviderConfig{
+		"local": {Type: "local-file", Path: filepath.Join(t.TempDir(), "secrets.db"), Encryption: &provider.EncryptionConfig{}},
+	}}
+	err := rotateLocalKey(context.Background(), globalCfg, "", "")
+	if err == nil || !strings.Contains(err.Error(), "key_file") || strings.Contains(err.Error(), "$;") {
+		t.Errorf("rotateLocalKey = %v, want an error naming key_file", err)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/spf13/cobra"
+)
+
+func newRenderCmd() *cobra.Command {
+	var envName string
+	var outPath string
+	var force bool
+	c := &cobra.Command{
+		Use:   "render --env ENV TEMPLATE [-o OUT]",
+		Short: "Render a config file template with secrets",
+		Long: `Render a Go text/template file with the env's secrets for tools that read
+secrets from files rather than environment variables.
+
+Secrets are available as fields of the top-level map ({{ .DATABASE_URL }}, or
+{{ index . "db/password" }} for names that are not identifiers). Helpers:
+
+  base64 VALUE             standard base64 encoding
+  jsonEscape VALUE         escape for use inside a JSON string
+  default FALLBACK VALUE   FALLBACK when VALUE is empty or missing
+  required MESSAGE VALUE   fail with MESSAGE when VALUE is empty or missing
+
+Output goes to stdout unless -o is given; files are written with 0600
+permissions and refused if tracked by git (use --force to override).
+
+Examples:
+  envmap render --env prod nginx.conf.tmpl -o /etc/nginx/conf.d/app.conf
+  envmap render --env dev config/database.yml.tmpl -o config/database.yml`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			projectCfg, _, err := loadProjectConfig()
+			if err != nil {
+				return err
+			}
+			globalCfg, err := LoadGlobalConfig("")
+			if err != nil {
+				return err
+			}
+			envToUse, err := ResolveEnv(projectCfg, envName)
+			if err != nil {
+				return err
+			}
+			secretEnv, err := CollectEnv(cmd.Context(), projectCfg, globalCfg, envToUse)
+			if err != nil {
+				return err
+			}
+			out, err := renderTemplate(args[0], secretEnv)
+			if err != nil {
+				return err
+			}
+			if outPath == "" || outPath == "-" {
+				_, err := os.Stdout.Write(out)
+				return err
+			}
+			if err := writeRendered(outPath, out, force); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Wrote %s from %s (env %s)\n", outPath, args[0], envToUse)
+			return nil
+		},
+	}
+	c.Flags().StringVar(&envName, "env", "", "environment name to use (defaults to project default_env)")
+	c.Flags().StringVarP(&outPath, "out", "o", "", "output file (default stdout)")
+	c.Flags().BoolVar(&force, "force", false, "write even if the output file is tracked by git")
+	return c
+}
+
+// templateFuncs are the helpers available to render templates.
+var templateFuncs = template.FuncMap{
+	"base64": func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	},
+	"jsonEscape": func(s string) (string, error) {
+		b, err := json.Marshal(s)
+		if err != nil {
+			return "", err
+		}
+		return string(b[1 : len(b)-1]), nil
+	},
+	"default": func(fallback, value string) string {
+		if value == "" {
+			return fallback
+		}
+		return value
+	},
+	"required": func(msg, value string) (string, error) {
+		if value == "" {
+			return "", errors.New(msg)
+		}
+		return value, nil
+	},
+}
+
+// renderTemplate executes the template at path with secrets as its data.
+// Missing keys render empty so default and required can handle them.
+func renderTemplate(path string, secrets map[string]string) ([]byte, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read template: %w", err)
+	}
+	tmpl, err := template.New(filepath.Base(path)).Funcs(templateFuncs).Option("missingkey=zero").Parse(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("parse template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, secrets); err != nil {
+		return nil, fmt.Errorf("render template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// writeRendered writes rendered secrets to dest with owner-only permissions.
+func writeRendered(dest string, content []byte, force bool) error {
+	if !force && isGitTracked(dest) {
+		return fmt.Errorf("%s appears tracked by git; rerun with --force to overwrite", dest)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return fmt.Errorf("create directory: %w", err)
+	}
+	// Replace rather than rewrite dest so an existing, more permissive file
+	// never holds the rendered secrets.
+	if err := replaceFile(dest, content); err != nil {
+		return fmt.Errorf("write %s: %w", dest, err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	dir := t.TempDir()
+	tmplPath := filepath.Join(dir, "app.tmpl")
+	src := `url={{ .DATABASE_URL }}
+slash={{ index . "db/password" }}
+b64={{ base64 .TOKEN }}
+json="{{ jsonEscape .QUOTED }}"
+port={{ .PORT | default "5432" }}
+`
+	if err := os.WriteFile(tmplPath, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := renderTemplate(tmplPath, map[string]string{
+		"DATABASE_URL": "postgres://db/app",
+		"db/password":  "pw",
+		"TOKEN":        "abc",
+		"QUOTED":       `say "hi"` + "\n",
+	})
+	if err != nil {
+		t.Fatalf("renderTemplate: %v", err)
+	}
+	want := `url=postgres://db/app
+slash=pw
+b64=YWJj
+json="say \"hi\"\n"
+port=5432
+`
+	if string(out) != want {
+		t.Errorf("rendered:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestRenderTemplateRequired(t *testing.T) {
+	dir := t.TempDir()
+	tmplPath := filepath.Join(dir, "app.tmpl")
+	if err := os.WriteFile(tmplPath, []byte(`{{ required "API_KEY must be set" .API_KEY }}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := renderTemplate(tmplPath, map[string]string{})
+	if err == nil || !strings.Contains(err.Error(), "API_KEY must be set") {
+		t.Errorf("renderTemplate error = %v, want required message", err)
+	}
+}
+
+func TestWriteRenderedPermissions(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "out", "app.conf")
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dest, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeRendered(dest, []byte("new"), false); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("mode = %o, want 600", perm)
+	}
+}
@@ -2,25 +2,445 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
 	"strings"
+	"syscall"
+	"time"
 )
 
-func SpawnWithEnv(ctx context.Context, command string, args []string, secretEnv map[string]string) error {
+// SecretFile asks SpawnWithEnv to deliver the secret Key as a file whose
+// path is exported to the child as Env.
+type SecretFile struct {
+	Key string
+	Env string
+}
+
+// Restart policies for RunOptions.Restart.
+const (
+	RestartNever     = "no"
+	RestartOnFailure = "on-failure"
+)
+
+// RunOptions controls how SpawnWithEnv delivers secrets and supervises the child.
+type RunOptions struct {
+	Files []SecretFile
+	// Restart is RestartNever or RestartOnFailure.
+	Restart string
+	// MaxRestarts caps restarts under RestartOnFailure; 0 means no limit.
+	MaxRestarts int
+	// Watch is how often Reload is called to look for changed secrets; 0
+	// disables watching.
+	Watch  time.Duration
+	Reload func(context.Context) (map[string]string, error)
+	// ReloadSignal is sent to the child when only file-delivered secrets
+	// change; nil, or a change to any other key, restarts it.
+	ReloadSignal os.Signal
+}
+
+// Backoff between restarts doubles from restartBackoff up to maxRestartBackoff
+// and starts over once a child has stayed up for restartResetAfter.
+var (
+	restartBackoff    = time.Second
+	maxRestartBackoff = 30 * time.Second
+	restartResetAfter = 30 * time.Second
+)
+
+// ExitError reports how the child finished when it did not exit cleanly, so
+// main can exit with the same status or signal.
+type ExitError struct {
+	Code   int
+	Signal os.Signal
+}
+
+func (e *ExitError) Error() string {
+	if e.Signal != nil {
+		return fmt.Sprintf("terminated by signal: %s", e.Signal)
+	}
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// SpawnWithEnv runs command with secretEnv added to the current environment.
+// Signals sent to envmap are forwarded to the child's process group, and the
+// child's exit status is returned as an *ExitError. Keys listed in
+// opts.Files are written to a private temporary directory instead of the
+// environment and removed once the child has exited for good.
+func SpawnWithEnv(ctx context.Context, command string, args []string, secretEnv map[string]string, opts RunOptions) error {
+	dir := ""
+	if len(opts.Files) > 0 {
+		var err error
+		if dir, err = makeSecretFilesDir(); err != nil {
+			return err
+		}
+		defer removeSecretFiles(dir)
+	}
+
+	// Stay alive until the child exits so signals reach it and cleanup runs.
+	sigs := make(chan os.Signal, 16)
+	signal.Notify(sigs, forwardedSignals...)
+	defer signal.Stop(sigs)
+
+	var updates <-chan map[string]string
+	if opts.Watch > 0 && opts.Reload != nil {
+		watchCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		updates = watchSecrets(watchCtx, opts.Watch, opts.Reload, secretEnv)
+	}
+	// onUpdate takes a changed secret set and reports whether the child must
+	// be restarted to see it. A signal is enough only when every changed key
+	// is file-delivered: a running process's environment cannot be updated.
+	onUpdate := func(next map[string]string) bool {
+		envChanged := changedEnvKeys(secretEnv, next, opts.Files)
+		secretEnv = next
+		if opts.ReloadSignal == nil {
+			return true
+		}
+		if len(envChanged) > 0 {
+			fmt.Fprintf(os.Stderr, "envmap: %s changed in the command's environment, which a signal cannot update\n", strings.Join(envChanged, ", "))
+			return true
+		}
+		if dir != "" {
+			if _, err := writeSecretFiles(dir, secretEnv, opts.Files); err != nil {
+				fmt.Fprintf(os.Stderr, "envmap: %v\n", err)
+			}
+		}
+		return false
+	}
+
+	backoff := restartBackoff
+	for restarts := 0; ; {
+		env, err := childEnviron(dir, secretEnv, opts.Files)
+		if err != nil {
+			return err
+		}
+		started := time.Now()
+		cause, err := superviseOnce(ctx, command, args, env, sigs, updates, onUpdate, opts.ReloadSignal)
+		if cause == exitReload {
+			fmt.Fprintln(os.Stderr, "envmap: restarting with updated secrets")
+			continue
+		}
+		var exitErr *ExitError
+		if !errors.As(err, &exitErr) || cause == exitStopped || opts.Restart != RestartOnFailure || ctx.Err() != nil {
+			return err
+		}
+		if exitErr.Signal != nil && isTerminating(exitErr.Signal) {
+			return err
+		}
+		if opts.MaxRestarts > 0 && restarts >= opts.MaxRestarts {
+			fmt.Fprintf(os.Stderr, "envmap: %s; giving up after %d restarts\n", err, restarts)
+			return err
+		}
+		restarts++
+		if time.Since(started) >= restartResetAfter {
+			backoff = restartBackoff
+		}
+		fmt.Fprintf(os.Stderr, "envmap: %s; restarting in %s\n", err, backoff)
+		if !sleepUnlessStopped(ctx, backoff, sigs) {
+			return err
+		}
+		backoff = min(backoff*2, maxRestartBackoff)
+	}
+}
+
+// childEnviron builds the child's environment, writing file-delivered
+// secrets into dir and exporting their paths instead of their values.
+func childEnviron(dir string, secretEnv map[string]string, files []SecretFile) ([]string, error) {
+	childEnv := secretEnv
+	if dir != "" {
+		paths, err := writeSecretFiles(dir, secretEnv, files)
+		if err != nil {
+			return nil, err
+		}
+		childEnv = make(map[string]string, len(secretEnv))
+		for k, v := range secretEnv {
+			childEnv[k] = v
+		}
+		for _, f := range files {
+			if path, ok := paths[f.Key]; ok {
+				delete(childEnv, f.Key)
+				childEnv[f.Env] = path
+			}
+		}
+	}
+	merged := os.Environ()
+	for k, v := range childEnv {
+		merged = append(merged, fmt.Sprintf("%s=%s", k, v))
+	}
+	return merged, nil
+}
+
+// Why superviseOnce returned.
+const (
+	exitChild   = iota // the child exited on its own
+	exitStopped        // a terminating signal was forwarded to the child
+	exitReload         // the child was stopped to pick up changed secrets
+)
+
+// reloadStopTimeout is how long a child stopped for a reload gets to exit
+// before it is killed.
+var reloadStopTimeout = 10 * time.Second
+
+// superviseOnce starts the child and forwards signals until it exits. Secret
+// sets received on updates are passed to onUpdate; the child is then either
+// sent reloadSig or, when onUpdate asks for it, stopped so it can be restarted.
+func superviseOnce(ctx context.Context, command string, args, env []string, sigs <-chan os.Signal, updates <-chan map[string]string, onUpdate func(map[string]string) bool, reloadSig os.Signal) (int, error) {
 	cmd := exec.CommandContext(ctx, command, args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Stdin = os.Stdin
+	cmd.Env = env
+	restore, foreground := configureChild(cmd)
+	defer restore()
+	if err := cmd.Start(); err != nil {
+		return exitChild, err
+	}
+	waitErr := make(chan error, 1)
+	go func() { waitErr <- cmd.Wait() }()
+	cause := exitChild
+	var kill <-chan time.Time
+	for {
+		select {
+		case sig := <-sigs:
+			if isTerminating(sig) {
+				cause = exitStopped
+			}
+			_ = signalChild(cmd, sig)
+		case next := <-updates:
+			if !onUpdate(next) {
+				_ = signalChild(cmd, reloadSig)
+				continue
+			}
+			if cause == exitChild {
+				cause = exitReload
+				if err := signalChild(cmd, syscall.SIGTERM); err != nil {
+					_ = cmd.Process.Kill()
+				}
+				kill = time.After(reloadStopTimeout)
+			}
+		case <-kill:
+			_ = cmd.Process.Kill()
+		case err := <-waitErr:
+			// A foreground child gets Ctrl-C from the terminal, not from
+			// envmap, so an exit reporting a handled interrupt is a stop too.
+			if cause == exitChild && foreground && interruptedExit(cmd.ProcessState.ExitCode()) {
+				cause = exitStopped
+			}
+			return cause, exitResult(cmd, err)
+		}
+	}
+}
 
-	merged := os.Environ()
-	for k, v := range secretEnv {
-		merged = append(merged, fmt.Sprintf("%s=%s", k, v))
+// watchSecrets calls reload every interval and sends each secret set that
+// differs from the last one, logging the names of the changed keys.
+func watchSecrets(ctx context.Context, interval time.Duration, reload func(context.Context) (map[string]string, error), current map[string]string) <-chan map[string]string {
+	out := make(chan map[string]string)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			next, err := reload(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					fmt.Fprintf(os.Stderr, "envmap: watch: %v\n", err)
+				}
+				continue
+			}
+			changed := changedKeys(current, next)
+			if len(changed) == 0 {
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "envmap: secrets changed: %s\n", strings.Join(changed, ", "))
+			select {
+			case out <- next:
+				current = next
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// changedKeys lists the sorted names of keys added, removed or modified
+// between old and next.
+func changedKeys(old, next map[string]string) []string {
+	var changed []string
+	for k, v := range next {
+		if prev, ok := old[k]; !ok {
+			changed = append(changed, k+" (added)")
+		} else if prev != v {
+			changed = append(changed, k)
+		}
+	}
+	for k := range old {
+		if _, ok := next[k]; !ok {
+			changed = append(changed, k+" (removed)")
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// changedEnvKeys lists the sorted names of keys added, removed or modified
+// between old and next that are delivered as environment variables rather
+// than files.
+func changedEnvKeys(old, next map[string]string, files []SecretFile) []string {
+	asFile := make(map[string]bool, len(files))
+	for _, f := range files {
+		asFile[f.Key] = true
+	}
+	var changed []string
+	for k, v := range next {
+		if prev, ok := old[k]; (!ok || prev != v) && !asFile[k] {
+			changed = append(changed, k)
+		}
 	}
-	cmd.Env = merged
+	for k := range old {
+		if _, ok := next[k]; !ok && !asFile[k] {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// exitResult turns the child's wait status into nil or an *ExitError.
+func exitResult(cmd *exec.Cmd, err error) error {
+	var execErr *exec.ExitError
+	if err != nil && !errors.As(err, &execErr) {
+		return err
+	}
+	if sig := exitSignal(cmd.ProcessState); sig != nil {
+		return &ExitError{Signal: sig}
+	}
+	if code := cmd.ProcessState.ExitCode(); code != 0 {
+		return &ExitError{Code: code}
+	}
+	return nil
+}
+
+// sleepUnlessStopped waits for d and reports false if envmap was asked to stop.
+func sleepUnlessStopped(ctx context.Context, d time.Duration, sigs <-chan os.Signal) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			return true
+		case <-ctx.Done():
+			return false
+		case sig := <-sigs:
+			if isTerminating(sig) {
+				return false
+			}
+		}
+	}
+}
 
-	return cmd.Run()
+// makeSecretFilesDir creates the private directory for file-delivered secrets.
+func makeSecretFilesDir() (string, error) {
+	dir, err := os.MkdirTemp(secretFilesBase(), "envmap-")
+	if err != nil {
+		return "", fmt.Errorf("create secret files directory: %w", err)
+	}
+	if err := os.Chmod(dir, 0o700); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("secure secret files directory: %w", err)
+	}
+	return dir, nil
+}
+
+// writeSecretFiles writes each file-delivered secret into dir and returns the
+// path per key. Files are replaced atomically so a child re-reading them never
+// sees a partial value; files for keys no longer present are removed. Keys
+// whose file names would collide are an error.
+func writeSecretFiles(dir string, secretEnv map[string]string, files []SecretFile) (map[string]string, error) {
+	paths := map[string]string{}
+	owners := map[string]string{}
+	for _, f := range files {
+		name := secretFileName(f.Key)
+		if other, taken := owners[name]; taken && other != f.Key {
+			return nil, fmt.Errorf("secret files for %s and %s would both be named %s; rename one of the keys", other, f.Key, name)
+		}
+		owners[name] = f.Key
+		path := filepath.Join(dir, name)
+		value, ok := secretEnv[f.Key]
+		if !ok {
+			os.Remove(path)
+			continue
+		}
+		if err := replaceFile(path, []byte(value)); err != nil {
+			return nil, fmt.Errorf("write secret file for %s: %w", f.Key, err)
+		}
+		paths[f.Key] = path
+	}
+	return paths, nil
+}
+
+// replaceFile atomically swaps data in at path through an owner-only
+// temporary file in the same directory.
+func replaceFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// secretFilesBase prefers a memory-backed filesystem so secrets never reach disk.
+func secretFilesBase() string {
+	if info, err := os.Stat("/dev/shm"); err == nil && info.IsDir() {
+		return "/dev/shm"
+	}
+	return os.TempDir()
+}
+
+// secretFileName turns a key into a safe file name.
+func secretFileName(key string) string {
+	if strings.Trim(key, ".") == "" {
+		return "_" + key
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '.' || r == '-' || r == '_' || (r >= '0' && r <= '9') || (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') {
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+// removeSecretFiles overwrites each file with zeros before deleting the directory.
+func removeSecretFiles(dir string) {
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if info, err := e.Info(); err == nil && info.Mode().IsRegular() {
+			if f, err := os.OpenFile(path, os.O_WRONLY, 0); err == nil {
+				f.Write(make([]byte, info.Size()))
+				f.Sync()
+				f.Close()
+			}
+		}
+	}
+	os.RemoveAll(dir)
 }
 
 func MaskValue(value string) string {
@@ -0,0 +1,34 @@
+//go:build !unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+var forwardedSignals = []os.Signal{os.Interrupt}
+
+func configureChild(cmd *exec.Cmd) (restore func(), foreground bool) { return func() {}, false }
+
+func signalChild(cmd *exec.Cmd, sig os.Signal) error {
+	return cmd.Process.Signal(sig)
+}
+
+func isTerminating(sig os.Signal) bool {
+	return sig == os.Interrupt || sig == os.Kill
+}
+
+func interruptedExit(code int) bool { return false }
+
+func exitSignal(state *os.ProcessState) os.Signal { return nil }
+
+// Exit ends envmap with the child's exit code.
+func (e *ExitError) Exit() {
+	os.Exit(e.Code)
+}
+
+func parseSignal(name string) (os.Signal, error) {
+	return nil, fmt.Errorf("sending %s is not supported on this platform", name)
+}
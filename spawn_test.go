@@ -1,6 +1,14 @@
 package main
 
-import "testing"
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
 
 func TestMaskValue(t *testing.T) {
 	tests := []struct {
@@ -52,3 +60,102 @@ func TestShellQuote(t *testing.T) {
 		})
 	}
 }
+
+func TestSpawnWithEnvSecretFiles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	out := filepath.Join(t.TempDir(), "out")
+	script := `printf '%s|%s|%s|%s\n' "$(cat "$TLS_CERT_FILE")" "$CA_PATH" "$(cat "$CA_PATH")" "$TLS_CERT" > "$OUT"; echo "$TLS_CERT_FILE" >> "$OUT"`
+	secretEnv := map[string]string{"TLS_CERT": "-----CERT-----", "CA": "ca-bundle", "OUT": out}
+	files := []SecretFile{{Key: "TLS_CERT", Env: "TLS_CERT_FILE"}, {Key: "CA", Env: "CA_PATH"}}
+	if err := SpawnWithEnv(context.Background(), "sh", []string{"-c", script}, secretEnv, RunOptions{Files: files}); err != nil {
+		t.Fatalf("SpawnWithEnv: %v", err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitN(strings.TrimSpace(string(b)), "\n", 2)
+	parts := strings.Split(lines[0], "|")
+	if len(parts) != 4 || parts[0] != "-----CERT-----" || parts[2] != "ca-bundle" || parts[3] != "" {
+		t.Errorf("child saw %q, want file contents and no TLS_CERT variable", lines[0])
+	}
+	if _, err := os.Stat(lines[1]); !os.IsNotExist(err) {
+		t.Errorf("secret file %s still exists after child exit", lines[1])
+	}
+	if _, err := os.Stat(filepath.Dir(lines[1])); !os.IsNotExist(err) {
+		t.Errorf("secret directory %s still exists after child exit", filepath.Dir(lines[1]))
+	}
+}
+
+func TestSecretFilesConfig(t *testing.T) {
+	cfg := ProjectConfig{Envs: map[string]EnvConfig{
+		"base": {
+			Required: []KeySpec{{Name: "TLS_CERT", As: DeliverFile}, {Name: "API_KEY"}},
+			Optional: []KeySpec{{Name: "SA_JSON", As: DeliverFile, FileEnv: "GOOGLE_APPLICATION_CREDENTIALS"}},
+		},
+		"prod": {
+			Extends:  "base",
+			Required: []KeySpec{{Name: "SA_JSON"}, {Name: "CA_CERT", As: DeliverFile}},
+		},
+	}}
+	got, err := cfg.SecretFiles("base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SecretFile{{Key: "TLS_CERT", Env: "TLS_CERT_FILE"}, {Key: "SA_JSON", Env: "GOOGLE_APPLICATION_CREDENTIALS"}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("SecretFiles(base) = %+v, want %+v", got, want)
+	}
+	// prod inherits TLS_CERT and redeclares SA_JSON as a plain variable.
+	got, err = cfg.SecretFiles("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []SecretFile{{Key: "CA_CERT", Env: "CA_CERT_FILE"}, {Key: "TLS_CERT", Env: "TLS_CERT_FILE"}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("SecretFiles(prod) = %+v, want %+v", got, want)
+	}
+	files := []SecretFile{{Key: "A/B", Env: "X"}, {Key: "A_B", Env: "Y"}}
+	if _, err := writeSecretFiles(t.TempDir(), map[string]string{"A/B": "1", "A_B": "2"}, files); err == nil || !strings.Contains(err.Error(), "both be named") {
+		t.Errorf("colliding file names: %v", err)
+	}
+	if err := (KeySpec{Name: "A", FileEnv: "X"}).validate(); err == nil {
+		t.Error("file_env without as: file accepted")
+	}
+	if err := (KeySpec{Name: "A", As: "pipe"}).validate(); err == nil {
+		t.Error("unknown as accepted")
+	}
+	if name := secretFileName("../etc/passwd"); strings.Contains(name, "/") {
+		t.Errorf("secretFileName kept a path separator: %q", name)
+	}
+	if name := secretFileName(".."); name == ".." {
+		t.Error("secretFileName returned ..")
+	}
+}
+
+func TestChangedKeys(t *testing.T) {
+	old := map[string]string{"A": "1", "B": "2", "C": "3"}
+	next := map[string]string{"A": "1", "B": "20", "D": "4"}
+	got := strings.Join(changedKeys(old, next), ", ")
+	if want := "B, C (removed), D (added)"; got != want {
+		t.Errorf("changedKeys = %q, want %q", got, want)
+	}
+	if changed := changedKeys(old, old); len(changed) != 0 {
+		t.Errorf("changedKeys(same) = %v", changed)
+	}
+}
+
+func TestChangedEnvKeys(t *testing.T) {
+	old := map[string]string{"A": "1", "B": "2", "C": "3"}
+	next := map[string]string{"A": "10", "B": "20", "D": "4"}
+	files := []SecretFile{{Key: "A", Env: "A_FILE"}}
+	got := strings.Join(changedEnvKeys(old, next, files), ", ")
+	if want := "B, C, D"; got != want {
+		t.Errorf("changedEnvKeys = %q, want %q", got, want)
+	}
+	if changed := changedEnvKeys(old, map[string]string{"A": "10", "B": "2", "C": "3"}, files); len(changed) != 0 {
+		t.Errorf("changedEnvKeys(file key only) = %v, want none", changed)
+	}
+}
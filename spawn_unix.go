@@ -0,0 +1,93 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// forwardedSignals are the signals envmap catches and passes on to the child.
+var forwardedSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGUSR1, syscall.SIGUSR2}
+
+// configureChild starts the child in its own process group so signals can be
+// forwarded to everything it spawns. On a terminal that group also becomes
+// the foreground group, so Ctrl-C and job control reach the child directly
+// and foreground is true; the returned func hands the terminal back to envmap.
+func configureChild(cmd *exec.Cmd) (restore func(), foreground bool) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		return func() {}, false
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Foreground: true, Ctty: fd}
+	return func() {
+		// A background process group must ignore SIGTTOU to take the terminal back.
+		signal.Ignore(syscall.SIGTTOU)
+		defer signal.Reset(syscall.SIGTTOU)
+		_ = unix.IoctlSetPointerInt(fd, unix.TIOCSPGRP, syscall.Getpgrp())
+	}, true
+}
+
+// signalChild delivers sig to the child's whole process group.
+func signalChild(cmd *exec.Cmd, sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return cmd.Process.Signal(sig)
+	}
+	return syscall.Kill(-cmd.Process.Pid, s)
+}
+
+// isTerminating reports whether sig asks the process to stop.
+func isTerminating(sig os.Signal) bool {
+	switch sig {
+	case syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT:
+		return true
+	}
+	return false
+}
+
+// interruptedExit reports whether an exit code is the 128+N a program uses
+// after handling a terminating signal N, such as 130 after Ctrl-C.
+func interruptedExit(code int) bool {
+	return code > 128 && code < 128+65 && isTerminating(syscall.Signal(code-128))
+}
+
+func exitSignal(state *os.ProcessState) os.Signal {
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return ws.Signal()
+	}
+	return nil
+}
+
+// Exit ends envmap the way the child ended: with its exit code, or by
+// re-raising the signal that killed it.
+func (e *ExitError) Exit() {
+	if s, ok := e.Signal.(syscall.Signal); ok {
+		signal.Reset(s)
+		_ = syscall.Kill(os.Getpid(), s)
+		time.Sleep(100 * time.Millisecond)
+		os.Exit(128 + int(s))
+	}
+	os.Exit(e.Code)
+}
+
+// parseSignal accepts a signal name such as HUP, SIGHUP or sigusr1.
+func parseSignal(name string) (os.Signal, error) {
+	upper := strings.ToUpper(name)
+	if !strings.HasPrefix(upper, "SIG") {
+		upper = "SIG" + upper
+	}
+	if s := unix.SignalNum(upper); s != 0 {
+		return s, nil
+	}
+	return nil, fmt.Errorf("unknown signal %q", name)
+}
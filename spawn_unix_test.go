@@ -0,0 +1,196 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSpawnWithEnvExitCode(t *testing.T) {
+	err := SpawnWithEnv(context.Background(), "sh", []string{"-c", "exit 3"}, nil, RunOptions{})
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("expected *ExitError, got %v", err)
+	}
+	if exitErr.Code != 3 || exitErr.Signal != nil {
+		t.Fatalf("got %+v, want exit code 3", exitErr)
+	}
+}
+
+func TestSpawnWithEnvKilledBySignal(t *testing.T) {
+	err := SpawnWithEnv(context.Background(), "sh", []string{"-c", "kill -TERM $$"}, nil, RunOptions{})
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("expected *ExitError, got %v", err)
+	}
+	if exitErr.Signal != syscall.SIGTERM {
+		t.Fatalf("got %+v, want SIGTERM", exitErr)
+	}
+}
+
+func TestSpawnWithEnvRestartOnFailure(t *testing.T) {
+	old := restartBackoff
+	restartBackoff = time.Millisecond
+	defer func() { restartBackoff = old }()
+
+	counter := filepath.Join(t.TempDir(), "runs")
+	script := `echo x >> "$COUNTER"; [ "$(wc -l < "$COUNTER")" -ge 3 ]`
+	env := map[string]string{"COUNTER": counter}
+	if err := SpawnWithEnv(context.Background(), "sh", []string{"-c", script}, env, RunOptions{Restart: RestartOnFailure}); err != nil {
+		t.Fatalf("SpawnWithEnv: %v", err)
+	}
+	if runs := countLines(t, counter); runs != 3 {
+		t.Fatalf("ran %d times, want 3", runs)
+	}
+
+	os.Remove(counter)
+	err := SpawnWithEnv(context.Background(), "sh", []string{"-c", "echo x >> \"$COUNTER\"; exit 1"}, env, RunOptions{Restart: RestartOnFailure, MaxRestarts: 2})
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 1 {
+		t.Fatalf("expected exit code 1 after giving up, got %v", err)
+	}
+	if runs := countLines(t, counter); runs != 3 {
+		t.Fatalf("ran %d times, want 3 (1 + 2 restarts)", runs)
+	}
+}
+
+func TestSpawnWithEnvForwardsSignals(t *testing.T) {
+	dir := t.TempDir()
+	ready := filepath.Join(dir, "ready")
+	got := filepath.Join(dir, "got")
+	script := `trap 'echo usr1 > "$GOT"; exit 0' USR1; touch "$READY"; while :; do sleep 0.05; done`
+	env := map[string]string{"READY": ready, "GOT": got}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- SpawnWithEnv(context.Background(), "sh", []string{"-c", script}, env, RunOptions{})
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(ready); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("child never became ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("SpawnWithEnv: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("child did not exit after SIGUSR1")
+	}
+	data, err := os.ReadFile(got)
+	if err != nil || strings.TrimSpace(string(data)) != "usr1" {
+		t.Fatalf("child did not receive SIGUSR1: %q, %v", data, err)
+	}
+}
+
+func TestSpawnWithEnvWatchRestarts(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	script := `echo "$TOKEN" >> "$OUT"; [ "$TOKEN" = v2 ] && exit 0; while :; do sleep 0.05; done`
+	reload := func(context.Context) (map[string]string, error) {
+		return map[string]string{"TOKEN": "v2", "OUT": out}, nil
+	}
+	opts := RunOptions{Watch: 10 * time.Millisecond, Reload: reload}
+	if err := SpawnWithEnv(context.Background(), "sh", []string{"-c", script}, map[string]string{"TOKEN": "v1", "OUT": out}, opts); err != nil {
+		t.Fatalf("SpawnWithEnv: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "v1\nv2\n" {
+		t.Fatalf("child runs saw %q, want v1 then v2", data)
+	}
+}
+
+func TestSpawnWithEnvWatchSignals(t *testing.T) {
+	dir := t.TempDir()
+	ready := filepath.Join(dir, "ready")
+	out := filepath.Join(dir, "out")
+	script := `trap 'cat "$TOKEN_FILE" > "$OUT"; exit 0' USR1; touch "$READY"; while :; do sleep 0.05; done`
+	secrets := map[string]string{"TOKEN": "v1", "OUT": out, "READY": ready}
+	reload := func(context.Context) (map[string]string, error) {
+		if _, err := os.Stat(ready); err != nil {
+			return secrets, nil
+		}
+		return map[string]string{"TOKEN": "v2", "OUT": out, "READY": ready}, nil
+	}
+	opts := RunOptions{
+		Files:        []SecretFile{{Key: "TOKEN", Env: "TOKEN_FILE"}},
+		Watch:        10 * time.Millisecond,
+		Reload:       reload,
+		ReloadSignal: syscall.SIGUSR1,
+	}
+	if err := SpawnWithEnv(context.Background(), "sh", []string{"-c", script}, secrets, opts); err != nil {
+		t.Fatalf("SpawnWithEnv: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "v2" {
+		t.Fatalf("child read %q from its secret file after reload, want v2", data)
+	}
+}
+
+func TestSpawnWithEnvWatchSignalRestartsForEnvKeys(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	script := `echo "$TOKEN" >> "$OUT"; [ "$TOKEN" = v2 ] && exit 0; trap 'echo signalled >> "$OUT"; exit 1' USR1; while :; do sleep 0.05; done`
+	reload := func(context.Context) (map[string]string, error) {
+		return map[string]string{"TOKEN": "v2", "OUT": out}, nil
+	}
+	opts := RunOptions{Watch: 10 * time.Millisecond, Reload: reload, ReloadSignal: syscall.SIGUSR1}
+	if err := SpawnWithEnv(context.Background(), "sh", []string{"-c", script}, map[string]string{"TOKEN": "v1", "OUT": out}, opts); err != nil {
+		t.Fatalf("SpawnWithEnv: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "v1\nv2\n" {
+		t.Fatalf("child runs saw %q, want a restart from v1 to v2 instead of a signal", data)
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	for _, name := range []string{"HUP", "SIGHUP", "hup"} {
+		if sig, err := parseSignal(name); err != nil || sig != syscall.SIGHUP {
+			t.Errorf("parseSignal(%q) = %v, %v", name, sig, err)
+		}
+	}
+	if _, err := parseSignal("NOPE"); err == nil {
+		t.Error("unknown signal accepted")
+	}
+}
+
+func TestInterruptedExit(t *testing.T) {
+	for code, want := range map[int]bool{130: true, 143: true, 129: true, 1: false, 128: false, 138: false, 255: false} {
+		if got := interruptedExit(code); got != want {
+			t.Errorf("interruptedExit(%d) = %v, want %v", code, got, want)
+		}
+	}
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(data), "\n")
+}
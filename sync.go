@@ -5,29 +5,57 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"sort"
 	"strings"
 	"time"
 
 	"github.com/binsquare/envmap/provider"
 )
 
-func syncEnvFile(dest string, records map[string]provider.SecretRecord, merge, keepLocal, force, backup bool) error {
-	existing := map[string]string{}
+// syncOptions controls how syncEnvFile reconciles provider secrets with an
+// existing file.
+type syncOptions struct {
+	Merge     bool
+	KeepLocal bool
+	Force     bool
+	Backup    bool
+	// Annotate writes a "# envmap: ..." comment with provenance above each
+	// key whose value comes from the provider.
+	Annotate bool
+	// Source labels records that carry no Source of their own.
+	Source string
+}
+
+// Comment lines syncEnvFile owns in an existing file.
+const (
+	syncHeaderPrefix  = "# generated by envmap sync"
+	syncManagedMarker = "# added by envmap sync"
+	syncAnnotation    = "# envmap: "
+)
+
+// syncEnvFile writes provider secrets to dest. An existing file is edited in
+// place: values are updated on their own lines, comments, blank lines and
+// ordering are kept, and keys new to the file are appended below a managed
+// marker. The file is left untouched when nothing changed. A file that does
+// not parse is rewritten from scratch unless --merge or --keep-local need its
+// values and --force was not given.
+func syncEnvFile(dest string, records map[string]provider.SecretRecord, opts syncOptions) error {
+	var src string
+	var entries []dotEnvEntry
 	if b, err := os.ReadFile(dest); err == nil {
-		lines := strings.Split(string(b), "\n")
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if line == "" || strings.HasPrefix(line, "#") {
-				continue
-			}
-			parts := strings.SplitN(line, "=", 2)
-			if len(parts) != 2 {
-				continue
+		src = string(b)
+		// Parse without the host environment so the result, and whether the
+		// file counts as up to date, does not depend on the caller's shell.
+		if entries, err = parseDotEnvEntries(dest, src, nil); err != nil {
+			if (opts.Merge || opts.KeepLocal) && !opts.Force {
+				return fmt.Errorf("%w (fix the file, or rerun with --force to regenerate it)", err)
 			}
-			existing[parts[0]] = parts[1]
+			fmt.Fprintf(os.Stderr, "envmap: %v; rewriting %s\n", err, dest)
+			src, entries = "", nil
 		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("read %s: %w", dest, err)
 	}
+	existing := dotEnvValues(entries)
 
 	final := map[string]string{}
 
@@ -37,7 +65,7 @@ func syncEnvFile(dest string, records map[string]provider.SecretRecord, merge, k
 	}
 
 	// Merge: keep keys only present in existing.
-	if merge {
+	if opts.Merge {
 		for k, v := range existing {
 			if _, ok := final[k]; !ok {
 				final[k] = v
@@ -46,7 +74,7 @@ func syncEnvFile(dest string, records map[string]provider.SecretRecord, merge, k
 	}
 
 	// Conflicts: keepLocal overrides provider.
-	if keepLocal {
+	if opts.KeepLocal {
 		for k, v := range existing {
 			if _, ok := final[k]; ok {
 				final[k] = v
@@ -54,8 +82,14 @@ func syncEnvFile(dest string, records map[string]provider.SecretRecord, merge, k
 		}
 	}
 
+	content := renderSyncedEnv(entries, final, records, opts)
+	if src != "" && content == src {
+		fmt.Printf("%s is up to date (%d secrets)\n", dest, len(final))
+		return nil
+	}
+
 	// Backup if requested and file exists.
-	if backup {
+	if opts.Backup {
 		if _, err := os.Stat(dest); err == nil {
 			bak := dest + ".bak"
 			if err := copyFile(dest, bak); err != nil {
@@ -65,23 +99,10 @@ func syncEnvFile(dest string, records map[string]provider.SecretRecord, merge, k
 	}
 
 	// Warn if tracked in git unless forced.
-	if !force && isGitTracked(dest) {
+	if !opts.Force && isGitTracked(dest) {
 		return fmt.Errorf("%s appears tracked by git; rerun with --force to overwrite", dest)
 	}
 
-	// Write file.
-	lines := []string{
-		fmt.Sprintf("# generated by envmap sync %s", time.Now().UTC().Format(time.RFC3339)),
-	}
-	keys := make([]string, 0, len(final))
-	for k := range final {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-	for _, k := range keys {
-		lines = append(lines, fmt.Sprintf("%s=%s", k, final[k]))
-	}
-	content := strings.Join(lines, "\n") + "\n"
 	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
 		return fmt.Errorf("create directory: %w", err)
 	}
@@ -92,24 +113,151 @@ func syncEnvFile(dest string, records map[string]provider.SecretRecord, merge, k
 	return nil
 }
 
+// renderSyncedEnv rebuilds the file from its parsed entries with final as
+// the desired values.
+func renderSyncedEnv(entries []dotEnvEntry, final map[string]string, records map[string]provider.SecretRecord, opts syncOptions) string {
+	// Only the last assignment of a key takes effect, so that is the one updated.
+	last := map[string]int{}
+	for i, e := range entries {
+		if e.Key != "" {
+			last[e.Key] = i
+		}
+	}
+	annotationFor := func(i int) bool {
+		return isSyncAnnotation(entries[i]) && i+1 < len(entries) && entries[i+1].Key != "" && last[entries[i+1].Key] == i+1
+	}
+
+	var lines []string
+	header, managedEnd := -1, -1
+	written := map[string]bool{}
+	for i, e := range entries {
+		switch {
+		case e.Key == "":
+			if annotationFor(i) {
+				// Emitted, refreshed or dropped together with its key below.
+				continue
+			}
+			if i == 0 && strings.HasPrefix(e.Raw, syncHeaderPrefix) {
+				header = len(lines)
+			}
+			if e.Raw == syncManagedMarker {
+				managedEnd = len(lines)
+			}
+			lines = append(lines, e.Raw)
+		case last[e.Key] != i:
+			if _, keep := final[e.Key]; keep {
+				lines = append(lines, e.Raw)
+			}
+		default:
+			value, keep := final[e.Key]
+			if !keep {
+				continue
+			}
+			written[e.Key] = true
+			if note := syncAnnotationLine(e.Key, final, records, opts); note != "" {
+				lines = append(lines, note)
+			} else if i > 0 && annotationFor(i-1) && value == e.Value {
+				lines = append(lines, entries[i-1].Raw)
+			}
+			if value == e.Value {
+				lines = append(lines, e.Raw)
+			} else {
+				line := formatDotEnvLine(e.Key, value)
+				if e.Export {
+					line = "export " + line
+				}
+				if e.Comment != "" {
+					line += " " + e.Comment
+				}
+				lines = append(lines, line)
+			}
+			if managedEnd >= 0 {
+				managedEnd = len(lines) - 1
+			}
+		}
+	}
+
+	var added []string
+	for _, k := range sortedKeys(final) {
+		if written[k] {
+			continue
+		}
+		if note := syncAnnotationLine(k, final, records, opts); note != "" {
+			added = append(added, note)
+		}
+		added = append(added, formatDotEnvLine(k, final[k]))
+	}
+	stamp := fmt.Sprintf("%s %s", syncHeaderPrefix, time.Now().UTC().Format(time.RFC3339))
+	switch {
+	case len(entries) == 0:
+		lines = append([]string{stamp}, added...)
+	case len(added) == 0:
+	case managedEnd >= 0:
+		lines = append(lines[:managedEnd+1], append(added, lines[managedEnd+1:]...)...)
+	default:
+		if len(lines) > 0 && lines[len(lines)-1] != "" {
+			lines = append(lines, "")
+		}
+		lines = append(lines, syncManagedMarker)
+		lines = append(lines, added...)
+	}
+	content := strings.Join(lines, "\n") + "\n"
+	if header >= 0 && len(entries) > 0 && content != joinEntries(entries) {
+		lines[header] = stamp
+		content = strings.Join(lines, "\n") + "\n"
+	}
+	return content
+}
+
+func joinEntries(entries []dotEnvEntry) string {
+	raws := make([]string, len(entries))
+	for i, e := range entries {
+		raws[i] = e.Raw
+	}
+	return strings.Join(raws, "\n") + "\n"
+}
+
+func isSyncAnnotation(e dotEnvEntry) bool {
+	return e.Key == "" && strings.HasPrefix(strings.TrimSpace(e.Raw), syncAnnotation)
+}
+
+// syncAnnotationLine describes where key's value came from, or returns ""
+// when annotations are off, the value is not the provider's or nothing is known.
+func syncAnnotationLine(key string, final map[string]string, records map[string]provider.SecretRecord, opts syncOptions) string {
+	rec, ok := records[key]
+	if !opts.Annotate || !ok || rec.Value != final[key] {
+		return ""
+	}
+	var notes []string
+	if !rec.CreatedAt.IsZero() {
+		notes = append(notes, "created "+rec.CreatedAt.UTC().Format(time.RFC3339))
+	}
+	source := rec.Source
+	if source == "" {
+		source = opts.Source
+	}
+	if source != "" {
+		notes = append(notes, "from "+source)
+	}
+	if len(notes) == 0 {
+		return ""
+	}
+	return syncAnnotation + strings.Join(notes, ", ")
+}
+
+// checkEnvDrift reports keys whose values differ between dest and records.
+// Like syncEnvFile it parses dest without the host environment, so sync and
+// sync --check agree on whether the file is up to date.
 func checkEnvDrift(dest string, records map[string]provider.SecretRecord) error {
-	existing := map[string]string{}
 	b, err := os.ReadFile(dest)
 	if err != nil {
 		return fmt.Errorf("read %s: %w", dest, err)
 	}
-	lines := strings.Split(string(b), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) != 2 {
-			continue
-		}
-		existing[parts[0]] = parts[1]
+	entries, err := parseDotEnvEntries(dest, string(b), nil)
+	if err != nil {
+		return err
 	}
+	existing := dotEnvValues(entries)
 
 	providerVals := map[string]string{}
 	for k, v := range records {
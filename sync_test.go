@@ -0,0 +1,218 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/binsquare/envmap/provider"
+)
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
+
+func TestSyncEnvFilePreservesLayout(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), ".env")
+	existing := `# generated by envmap sync 2025-01-01T00:00:00Z
+# Database
+DB_HOST=localhost   # local override
+export DB_PASS='old'
+
+# Feature flags
+FLAG=on
+LOCAL_ONLY=1
+`
+	if err := os.WriteFile(dest, []byte(existing), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	records := map[string]provider.SecretRecord{
+		"DB_HOST": {Value: "db.internal"},
+		"DB_PASS": {Value: "new pass"},
+		"FLAG":    {Value: "on"},
+		"NEW_B":   {Value: "b"},
+		"NEW_A":   {Value: "a"},
+	}
+	if err := syncEnvFile(dest, records, syncOptions{Force: true}); err != nil {
+		t.Fatalf("syncEnvFile: %v", err)
+	}
+	got := readLines(t, dest)
+	want := []string{
+		"", // header, checked below
+		"# Database",
+		"DB_HOST=db.internal # local override",
+		`export DB_PASS="new pass"`,
+		"",
+		"# Feature flags",
+		"FLAG=on",
+		"",
+		"# added by envmap sync",
+		"NEW_A=a",
+		"NEW_B=b",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(got), len(want), strings.Join(got, "\n"))
+	}
+	if !strings.HasPrefix(got[0], syncHeaderPrefix) || got[0] == "# generated by envmap sync 2025-01-01T00:00:00Z" {
+		t.Errorf("header not refreshed: %q", got[0])
+	}
+	for i := 1; i < len(want); i++ {
+		if got[i] != want[i] {
+			t.Errorf("line %d = %q, want %q", i+1, got[i], want[i])
+		}
+	}
+
+	// A second sync with nothing new leaves the file byte-for-byte alone.
+	before, _ := os.ReadFile(dest)
+	if err := syncEnvFile(dest, records, syncOptions{Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := os.ReadFile(dest); string(after) != string(before) {
+		t.Errorf("unchanged sync rewrote the file:\n%s", after)
+	}
+
+	// New keys join the managed block rather than starting another one.
+	records["NEW_C"] = provider.SecretRecord{Value: "c"}
+	if err := syncEnvFile(dest, records, syncOptions{Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	got = readLines(t, dest)
+	if tail := strings.Join(got[len(got)-4:], "\n"); tail != "# added by envmap sync\nNEW_A=a\nNEW_B=b\nNEW_C=c" {
+		t.Errorf("managed block = %q", tail)
+	}
+}
+
+func TestSyncEnvFileMerge(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(dest, []byte("LOCAL_ONLY=1\nSHARED=local\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	records := map[string]provider.SecretRecord{"SHARED": {Value: "remote"}}
+	if err := syncEnvFile(dest, records, syncOptions{Merge: true, Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(readLines(t, dest), "\n"); got != "LOCAL_ONLY=1\nSHARED=remote" {
+		t.Errorf("merge produced %q", got)
+	}
+	if err := syncEnvFile(dest, map[string]provider.SecretRecord{"SHARED": {Value: "again"}}, syncOptions{KeepLocal: true, Merge: true, Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(readLines(t, dest), "\n"); got != "LOCAL_ONLY=1\nSHARED=remote" {
+		t.Errorf("keep-local produced %q", got)
+	}
+}
+
+func TestSyncEnvFileAnnotate(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(dest, []byte("# app\nAPI_KEY=old\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	records := map[string]provider.SecretRecord{
+		"API_KEY": {Value: "new", CreatedAt: created},
+		"DB_URL":  {Value: "postgres://db", Source: "vault:shared/"},
+	}
+	opts := syncOptions{Annotate: true, Force: true, Source: "local:demo/dev/"}
+	if err := syncEnvFile(dest, records, opts); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"# app",
+		"# envmap: created 2025-03-01T12:00:00Z, from local:demo/dev/",
+		"API_KEY=new",
+		"",
+		"# added by envmap sync",
+		"# envmap: from vault:shared/",
+		"DB_URL=postgres://db",
+	}
+	if got := readLines(t, dest); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("annotated file:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Re-syncing keeps annotations stable; dropping --annotate removes the
+	// stale one when a value changes.
+	if err := syncEnvFile(dest, records, opts); err != nil {
+		t.Fatal(err)
+	}
+	records["API_KEY"] = provider.SecretRecord{Value: "rotated"}
+	if err := syncEnvFile(dest, records, syncOptions{Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(readLines(t, dest), "\n")
+	if want := "# app\nAPI_KEY=rotated\n\n# added by envmap sync\n# envmap: from vault:shared/\nDB_URL=postgres://db"; got != want {
+		t.Errorf("after rotation:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSyncEnvFileNewFile(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "sub", ".env")
+	records := map[string]provider.SecretRecord{"B": {Value: "two words"}, "A": {Value: "1"}}
+	if err := syncEnvFile(dest, records, syncOptions{Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	got := readLines(t, dest)
+	if len(got) != 3 || !strings.HasPrefix(got[0], syncHeaderPrefix) || got[1] != "A=1" || got[2] != `B="two words"` {
+		t.Errorf("new file = %q", got)
+	}
+}
+
+func TestSyncEnvFileUnparsable(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(dest, []byte("LOCAL=1\nBROKEN='unterminated\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	records := map[string]provider.SecretRecord{"A": {Value: "1"}}
+	if err := syncEnvFile(dest, records, syncOptions{Merge: true}); err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Fatalf("merge into unparsable file: %v, want an error suggesting --force", err)
+	}
+	// Without a merge option the old values are not needed, so it is rewritten.
+	if err := syncEnvFile(dest, records, syncOptions{Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readLines(t, dest); len(got) != 2 || got[1] != "A=1" {
+		t.Errorf("rewritten file = %q", got)
+	}
+}
+
+func TestSyncEnvFileIgnoresHostEnv(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(dest, []byte("URL=http://${ENVMAP_TEST_HOST}/\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ENVMAP_TEST_HOST", "example.com")
+	records := map[string]provider.SecretRecord{"URL": {Value: "http://example.com/"}}
+	if err := syncEnvFile(dest, records, syncOptions{Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readLines(t, dest); len(got) != 1 || got[0] != "URL=http://example.com/" {
+		t.Errorf("file = %q, want the provider value written", got)
+	}
+}
+
+func TestCheckEnvDriftIgnoresHostEnv(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(dest, []byte("URL=http://${ENVMAP_TEST_HOST}/\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ENVMAP_TEST_HOST", "example.com")
+	records := map[string]provider.SecretRecord{"URL": {Value: "http://example.com/"}}
+	if err := checkEnvDrift(dest, records); err == nil {
+		t.Error("checkEnvDrift reported no drift by expanding the host environment")
+	}
+
+	// Once sync has written the file, --check agrees it is up to date.
+	if err := syncEnvFile(dest, records, syncOptions{Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ENVMAP_TEST_HOST", "other.example")
+	if err := checkEnvDrift(dest, records); err != nil {
+		t.Errorf("checkEnvDrift after sync = %v, want no drift", err)
+	}
+}